@@ -0,0 +1,253 @@
+package fieldsRecognition
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"tucklejudge/fieldsRecognition/AI"
+	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn"
+	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
+)
+
+var debugSquareColor = color.RGBA{R: 255, A: 255}
+var debugFieldColor = color.RGBA{B: 255, A: 255}
+var debugCellColor = color.RGBA{G: 180, A: 255}
+var debugDoubtfulCellColor = color.RGBA{R: 255, G: 140, A: 255}
+var debugOutlierColor = color.RGBA{R: 255, A: 255}
+
+// debugTrace collects decisions of the stages of recognition into the debug bundle of the page,
+// every stage calls it, a nil trace means the page isn't debugged
+type debugTrace struct {
+	bundle *utils.DebugBundle
+	outlines [][4]Point // fields and cells on the standardized document
+	colors []color.RGBA
+}
+
+func newDebugTrace(inputImage string) *debugTrace {
+	return &debugTrace{bundle: &utils.DebugBundle{
+		ID: utils.DebugBundleID(inputImage),
+		InputImage: inputImage,
+		Squares: make([]utils.DebugSquare, 0),
+		Transform: make([]string, 0),
+		Cells: make([]utils.DebugCell, 0),
+	}}
+}
+
+func debugSquares(squares [][]IntPair) []utils.DebugSquare {
+	result := make([]utils.DebugSquare, len(squares))
+	for i, comp := range squares {
+		minX, minY, maxX, maxY := math.MaxInt, math.MaxInt, 0, 0
+		for _, point := range comp {
+			minX = min(minX, point.first)
+			minY = min(minY, point.second)
+			maxX = max(maxX, point.first)
+			maxY = max(maxY, point.second)
+		}
+		result[i] = utils.DebugSquare{X: minX, Y: minY, W: maxX - minX + 1, H: maxY - minY + 1}
+	}
+	return result
+}
+
+// withSquares copies the image and outlines the squares on it
+func withSquares(img image.Image, squares []utils.DebugSquare) *image.RGBA {
+	result := image.NewRGBA(img.Bounds())
+	draw.Draw(result, result.Bounds(), img, img.Bounds().Min, draw.Src)
+	for _, s := range squares {
+		x0, y0, x1, y1 := float64(s.X-2), float64(s.Y-2), float64(s.X+s.W+1), float64(s.Y+s.H+1)
+		drawOutline(result, [4]Point{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}, debugSquareColor)
+	}
+	return result
+}
+
+func drawLine(img *image.RGBA, a, b Point, c color.RGBA) {
+	steps := int(math.Max(math.Abs(b.x-a.x), math.Abs(b.y-a.y))) + 1
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		img.SetRGBA(int(a.x+t*(b.x-a.x)+0.5), int(a.y+t*(b.y-a.y)+0.5), c)
+	}
+}
+
+func drawOutline(img *image.RGBA, corners [4]Point, c color.RGBA) {
+	for i := range corners {
+		drawLine(img, corners[i], corners[(i+1)%4], c)
+	}
+}
+
+// foundSquares is called when the squares are looked for on the page made smaller
+func (trace *debugTrace) foundSquares(pic image.Image, squares [][]IntPair) {
+	if trace == nil {
+		return
+	}
+	trace.bundle.Squares = debugSquares(squares)
+	trace.bundle.SquaresImage = utils.SaveImageToSrc(withSquares(pic, trace.bundle.Squares))
+}
+
+// marks is called when the page is straightened, the marks are crossed where they were found,
+// the ones which agree with the homography green and the rest red
+func (trace *debugTrace) marks(doc image.Image, h *Matrix, marks []markPair, inliers []bool) {
+	if trace == nil {
+		return
+	}
+	result := image.NewRGBA(doc.Bounds())
+	draw.Draw(result, result.Bounds(), doc, doc.Bounds().Min, draw.Src)
+	inverse := getInverseMatrix(*h)
+	for i, mark := range marks {
+		c := debugCellColor
+		if !inliers[i] {
+			c = debugOutlierColor
+		}
+		p := inverse.project(mark.photo)
+		drawLine(result, Point{p.x - 4, p.y - 4}, Point{p.x + 4, p.y + 4}, c)
+		drawLine(result, Point{p.x - 4, p.y + 4}, Point{p.x + 4, p.y - 4}, c)
+	}
+	trace.bundle.StraightenedImage = utils.SaveImageToSrc(result)
+}
+
+func matrixString(m *Matrix) string {
+	return fmt.Sprintf("[%.4g %.4g %.4g; %.4g %.4g %.4g; %.4g %.4g %.4g]",
+		m.matrix[0][0], m.matrix[0][1], m.matrix[0][2],
+		m.matrix[1][0], m.matrix[1][1], m.matrix[1][2],
+		m.matrix[2][0], m.matrix[2][1], m.matrix[2][2])
+}
+
+func (trace *debugTrace) transform(format string, args ...interface{}) {
+	if trace == nil {
+		return
+	}
+	trace.bundle.Transform = append(trace.bundle.Transform, fmt.Sprintf(format, args...))
+}
+
+// fieldToDocument maps a point of the field given in parts of its width and height to the standardized document
+func fieldToDocument(layout *formLayout.Layout, field *formLayout.Field, u, v float64, corners [3]Point) Point {
+	return pageToDocumentPoint(layout, field.X+u*field.W, field.Y+v*field.H, corners)
+}
+
+func (trace *debugTrace) field(layout *formLayout.Layout, field *formLayout.Field, corners [3]Point) {
+	if trace == nil {
+		return
+	}
+	trace.bundle.Layout = layout.Name
+	trace.outlines = append(trace.outlines, [4]Point{
+		fieldToDocument(layout, field, 0, 0, corners),
+		fieldToDocument(layout, field, 1, 0, corners),
+		fieldToDocument(layout, field, 1, 1, corners),
+		fieldToDocument(layout, field, 0, 1, corners),
+	})
+	trace.colors = append(trace.colors, debugFieldColor)
+}
+
+// cell keeps the crop of the cell and the guesses of every classifier, the ones not used for reading are run here
+func (trace *debugTrace) cell(layout *formLayout.Layout, field *formLayout.Field, corners [3]Point, fieldImg *image.Gray, blockRect image.Rectangle, block int, analytics []int, reading formLayout.CellReading) {
+	if trace == nil {
+		return
+	}
+	width, height := float64(fieldImg.Bounds().Dx()), float64(fieldImg.Bounds().Dy())
+	u0, v0 := float64(blockRect.Min.X)/width, float64(blockRect.Min.Y)/height
+	u1, v1 := float64(blockRect.Max.X)/width, float64(blockRect.Max.Y)/height
+	trace.outlines = append(trace.outlines, [4]Point{
+		fieldToDocument(layout, field, u0, v0, corners),
+		fieldToDocument(layout, field, u1, v0, corners),
+		fieldToDocument(layout, field, u1, v1, corners),
+		fieldToDocument(layout, field, u0, v1, corners),
+	})
+	if reading.Confidence < 0.5 {
+		trace.colors = append(trace.colors, debugDoubtfulCellColor)
+	} else {
+		trace.colors = append(trace.colors, debugCellColor)
+	}
+
+	cell := utils.DebugCell{
+		Field: formLayout.FieldName(field.Role, field.Question),
+		Cell: block + 1,
+		Digit: reading.Digit,
+		Void: reading.Void,
+		Confidence: reading.Confidence,
+	}
+	crop := imageFragmentTo28x28cnnVersion(blockRect, fieldImg)
+	if crop != nil {
+		cell.CropImage = utils.SaveImageToSrc(cropToImage(crop, 3))
+	}
+	probabilities := reading.Probabilities
+	if PERCEPTRON {
+		probabilities = digitProbabilities(crop)
+	}
+	network := utils.DebugPrediction{Classifier: "network", Top: make([]utils.DebugGuess, 0)}
+	for _, digit := range topDigits(cnn.DigitsByProbability(probabilities)) {
+		guess := utils.DebugGuess{Digit: digit}
+		if probabilities != nil {
+			guess.Score = probabilities[digit]
+		}
+		network.Top = append(network.Top, guess)
+	}
+	perceptron := utils.DebugPrediction{Classifier: "perceptrons", Top: make([]utils.DebugGuess, 0)}
+	for _, digit := range topDigits(AI.GetPrediction(imageFragmentTo28x28PerceptronVersion(blockRect, fieldImg), perceptrons)) {
+		perceptron.Top = append(perceptron.Top, utils.DebugGuess{Digit: digit})
+	}
+	// analytics tell which digits are possible by the shape, they aren't ordered
+	shapes := utils.DebugPrediction{Classifier: "shape analytics", Top: make([]utils.DebugGuess, 0)}
+	for _, digit := range topDigits(analytics) {
+		shapes.Top = append(shapes.Top, utils.DebugGuess{Digit: digit})
+	}
+	cell.Predictions = []utils.DebugPrediction{network, perceptron, shapes}
+	trace.bundle.Cells = append(trace.bundle.Cells, cell)
+}
+
+// cancel outlines the cancel box of the field, it's red when the box is ticked
+func (trace *debugTrace) cancel(layout *formLayout.Layout, field *formLayout.Field, corners [3]Point, ink float64) {
+	if trace == nil {
+		return
+	}
+	box := field.Cancel
+	trace.outlines = append(trace.outlines, [4]Point{
+		pageToDocumentPoint(layout, box.X, box.Y, corners),
+		pageToDocumentPoint(layout, box.X+box.W, box.Y, corners),
+		pageToDocumentPoint(layout, box.X+box.W, box.Y+box.H, corners),
+		pageToDocumentPoint(layout, box.X, box.Y+box.H, corners),
+	})
+	switch {
+	case ink >= CANCEL_INK:
+		trace.colors = append(trace.colors, debugOutlierColor)
+	case ink >= BLANK_INK:
+		trace.colors = append(trace.colors, debugDoubtfulCellColor)
+	default:
+		trace.colors = append(trace.colors, debugCellColor)
+	}
+}
+
+func topDigits(digits []int) []int {
+	return digits[:min(len(digits), 3)]
+}
+
+// cropToImage turns the 28x28 input of the network into an image enlarged scale times
+func cropToImage(crop []int, scale int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 28*scale, 28*scale))
+	for x := 0; x < 28*scale; x++ {
+		for y := 0; y < 28*scale; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(crop[(y/scale)*28+x/scale])})
+		}
+	}
+	return img
+}
+
+// document saves the standardized document with the fields and cells outlined
+func (trace *debugTrace) document(doc image.Image) {
+	if trace == nil {
+		return
+	}
+	result := image.NewRGBA(doc.Bounds())
+	draw.Draw(result, result.Bounds(), doc, doc.Bounds().Min, draw.Src)
+	for i, outline := range trace.outlines {
+		drawOutline(result, outline, trace.colors[i])
+	}
+	trace.bundle.DocumentImage = utils.SaveImageToSrc(result)
+}
+
+func (trace *debugTrace) fail(err error) {
+	if trace == nil || err == nil {
+		return
+	}
+	trace.bundle.Error = err.Error()
+}
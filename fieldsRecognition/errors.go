@@ -0,0 +1,34 @@
+package fieldsRecognition
+
+import (
+	"errors"
+	"fmt"
+)
+
+// kinds of problems with pages, errors.Is(err, ErrNoFiducials) tells whether a page error is of the kind
+var ErrNoFiducials = errors.New("Fiducial squares are not found")
+var ErrUnreadableImage = errors.New("Image can't be read")
+var ErrUnknownStudent = errors.New("Student ID is unknown")
+var ErrUnknownTest = errors.New("Test ID is unknown")
+var ErrTooLarge = errors.New("File is too large")
+
+// PageError is returned for a page that wasn't read
+type PageError struct {
+	Kind error
+	Details string
+}
+
+func (err *PageError) Error() string {
+	if err.Details == "" {
+		return err.Kind.Error()
+	}
+	return err.Kind.Error() + ": " + err.Details
+}
+
+func (err *PageError) Unwrap() error {
+	return err.Kind
+}
+
+func pageError(kind error, format string, args ...interface{}) error {
+	return &PageError{Kind: kind, Details: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,325 @@
+package fieldsRecognition
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/gen2brain/go-fitz"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/gif"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// kinds of uploaded files, they're told by the first bytes of the file and not by its name
+const FILE_PDF = "pdf"
+const FILE_ZIP = "zip"
+const FILE_TIFF = "tiff" // may have many pages
+const FILE_IMAGE = "image" // PNG, JPEG, BMP, GIF or WebP, image.Decode recognizes the format itself
+
+func sniffFile(filepath string) (string, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return "", pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	defer f.Close()
+	head := make([]byte, 8)
+	n, _ := io.ReadFull(f, head)
+	return sniffHead(head[:n]), nil
+}
+
+// sniffHead tells the kind of a file by its first 8 bytes
+func sniffHead(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF")):
+		return FILE_PDF
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return FILE_ZIP
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return FILE_TIFF
+	}
+	return FILE_IMAGE
+}
+
+func checkPageCount(n int) error {
+	if n > maxPages {
+		return pageError(ErrTooLarge, "the file has %d pages, at most %d are allowed", n, maxPages)
+	}
+	if n == 0 {
+		return pageError(ErrUnreadableImage, "the file has no pages")
+	}
+	return nil
+}
+
+// readSeekCloser is a page of a file, decoders of TIFF read it at random places
+type readSeekCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// decodePage decodes an image of any registered format, the size is read from the header first,
+// so a huge image isn't decoded, the page is opened twice because readers of archives can't seek
+func decodePage(open func() (io.ReadCloser, error)) (image.Image, error) {
+	r, err := open()
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(r)
+	r.Close()
+	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	err = checkPixels(config.Width, config.Height)
+	if err != nil {
+		return nil, err
+	}
+	r, err = open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	return img, nil
+}
+
+func openImageFile(filepath string) (*readSeekCloser, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	return &readSeekCloser{io.NewSectionReader(f, 0, info.Size()), f}, nil
+}
+
+// tiffPages returns the byte order and offsets of the directories of a TIFF file, every directory is a page
+func tiffPages(f io.ReaderAt) (binary.ByteOrder, []uint32, error) {
+	header := make([]byte, 8)
+	_, err := f.ReadAt(header, 0)
+	if err != nil {
+		return nil, nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+	offsets := make([]uint32, 0)
+	visited := make(map[uint32]bool)
+	for offset := order.Uint32(header[4:]); offset != 0 && !visited[offset]; {
+		// a file with too many pages isn't read to the end
+		if len(offsets) > maxPages {
+			break
+		}
+		visited[offset] = true
+		offsets = append(offsets, offset)
+		count := make([]byte, 2)
+		_, err = f.ReadAt(count, int64(offset))
+		if err != nil {
+			return nil, nil, pageError(ErrUnreadableImage, "directory %d of the TIFF is broken", len(offsets))
+		}
+		next := make([]byte, 4)
+		_, err = f.ReadAt(next, int64(offset)+2+12*int64(order.Uint16(count)))
+		if err != nil {
+			return nil, nil, pageError(ErrUnreadableImage, "directory %d of the TIFF is broken", len(offsets))
+		}
+		offset = order.Uint32(next)
+	}
+	return order, offsets, nil
+}
+
+// tiffPage shows the file to the decoder as if the page's directory was the first one
+type tiffPage struct {
+	f io.ReaderAt
+	first [4]byte
+}
+
+func (page *tiffPage) ReadAt(p []byte, off int64) (int, error) {
+	n, err := page.f.ReadAt(p, off)
+	for i := 0; i < n; i++ {
+		if off+int64(i) >= 4 && off+int64(i) < 8 {
+			p[i] = page.first[off+int64(i)-4]
+		}
+	}
+	return n, err
+}
+
+func openTiffPage(file *readSeekCloser, offsets []uint32, order binary.ByteOrder, page int) (*readSeekCloser, error) {
+	if page >= len(offsets) {
+		return nil, pageError(ErrUnreadableImage, "the TIFF has no page %d", page+1)
+	}
+	tiff := &tiffPage{f: file}
+	order.PutUint32(tiff.first[:], offsets[page])
+	// the file is shared by the pages, it's closed with them
+	return &readSeekCloser{io.NewSectionReader(tiff, 0, file.Size()), io.NopCloser(nil)}, nil
+}
+
+// zipPages returns the files of the archive in the order of their names, folders and hidden files are skipped
+func zipPages(archive *zip.Reader) []*zip.File {
+	files := make([]*zip.File, 0)
+	for _, f := range archive.File {
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files
+}
+
+// zipPage is a file of the archive streamed to the decoder, it isn't read into memory
+type zipPage struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// openZipPage opens a file of the archive, only images can be pages of an archive,
+// PDF, TIFF and archives in it are told by their first bytes and their pages fail
+func openZipPage(file *zip.File) (io.ReadCloser, error) {
+	// the size in the header may be wrong, decodePage checks the size of the image as well
+	if file.UncompressedSize64 > uint64(maxPagePixels)*4 {
+		return nil, pageError(ErrTooLarge, "%s is bigger than a page can be", file.Name)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s: %s", file.Name, err.Error())
+	}
+	page := &zipPage{bufio.NewReader(f), f}
+	head, _ := page.Peek(8)
+	if kind := sniffHead(head); kind != FILE_IMAGE {
+		f.Close()
+		return nil, pageError(ErrUnreadableImage, "%s is a %s file, only images can be in the archive", file.Name, strings.ToUpper(kind))
+	}
+	return page, nil
+}
+
+// Pages is an uploaded file opened once for all its pages, the pages may be read at the same time
+type Pages struct {
+	filepath string
+	kind string
+	count int
+	pdf *fitz.Document // fitz renders the pages of a document one at a time
+	tiff *readSeekCloser
+	tiffOrder binary.ByteOrder
+	tiffOffsets []uint32
+	zip *zip.ReadCloser
+	zipFiles []*zip.File
+}
+
+// OpenPages opens the uploaded file, a photo has one page and an archive a page for every file,
+// the pages are read with BringTestResultsFromPage and the file is closed with Close
+func OpenPages(filepath string) (*Pages, error) {
+	kind, err := sniffFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	pages := &Pages{filepath: filepath, kind: kind, count: 1}
+	switch kind {
+	case FILE_PDF:
+		pages.pdf, err = openPdf(filepath)
+		if err != nil {
+			return nil, err
+		}
+		pages.count = pages.pdf.NumPage()
+	case FILE_TIFF:
+		pages.tiff, err = openImageFile(filepath)
+		if err != nil {
+			return nil, err
+		}
+		pages.tiffOrder, pages.tiffOffsets, err = tiffPages(pages.tiff)
+		pages.count = len(pages.tiffOffsets)
+	case FILE_ZIP:
+		pages.zip, err = zip.OpenReader(filepath)
+		if err != nil {
+			return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+		}
+		pages.zipFiles = zipPages(&pages.zip.Reader)
+		pages.count = len(pages.zipFiles)
+	}
+	if err == nil {
+		err = checkPageCount(pages.count)
+	}
+	if err != nil {
+		pages.Close()
+		return nil, err
+	}
+	return pages, nil
+}
+
+func (pages *Pages) Count() int {
+	return pages.count
+}
+
+func (pages *Pages) Close() error {
+	if pages.pdf != nil {
+		return pages.pdf.Close()
+	}
+	if pages.tiff != nil {
+		return pages.tiff.Close()
+	}
+	if pages.zip != nil {
+		return pages.zip.Close()
+	}
+	return nil
+}
+
+// CountPages returns the number of pages of the uploaded file
+func CountPages(filepath string) (int, error) {
+	pages, err := OpenPages(filepath)
+	if err != nil {
+		return 0, err
+	}
+	defer pages.Close()
+	return pages.Count(), nil
+}
+
+// image decodes one page of the file, the errors are page errors
+func (pages *Pages) image(page int) (image.Image, error) {
+	switch pages.kind {
+	case FILE_PDF:
+		return renderPdfPage(pages.pdf, page)
+	case FILE_TIFF:
+		return decodePage(func() (io.ReadCloser, error) {
+			return openTiffPage(pages.tiff, pages.tiffOffsets, pages.tiffOrder, page)
+		})
+	case FILE_ZIP:
+		if page >= len(pages.zipFiles) {
+			return nil, pageError(ErrUnreadableImage, "the archive has no page %d", page+1)
+		}
+		return decodePage(func() (io.ReadCloser, error) { return openZipPage(pages.zipFiles[page]) })
+	}
+	return decodePage(func() (io.ReadCloser, error) { return openImageFile(pages.filepath) })
+}
+
+// BringTestResultsFromPage reads one page of the uploaded file, so big files can be checked page by page,
+// an error is returned only when there are no layouts, problems of the page are in its result
+func BringTestResultsFromPage(pages *Pages, page int, layoutName string, debug bool) (PageResult, error) {
+	layouts, err := getLayouts(layoutName)
+	if err != nil {
+		return PageResult{}, err
+	}
+	// the page is decoded in its slot as well, so waiting pages don't take memory
+	var result PageResult
+	withPageSlot(func() {
+		img, err := pages.image(page)
+		if err != nil {
+			result = PageResult{Err: err}
+			return
+		}
+		result = readPage(img, layouts, debug)
+	})
+	return result, nil
+}
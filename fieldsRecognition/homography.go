@@ -0,0 +1,289 @@
+package fieldsRecognition
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"tucklejudge/utils/formLayout"
+)
+
+// MAX_RESIDUAL is the most mean distance in pixels of the standardized document between the marks found on the page
+// and the places the homography puts them, a page above it is distorted too much to be graded without review
+const MAX_RESIDUAL = 3.0
+const RANSAC_ITERATIONS = 300
+// a mark is an inlier of the homography when it's put this near, in pixels of the standardized document
+const RANSAC_INLIER_DISTANCE = 2.5
+// edges of the fields are looked for this far from their expected places, in pixels of the standardized document,
+// it's less than half of a cell, so the dividers of the cells aren't taken for the edges
+const EDGE_SEARCH = 12.
+// an edge is found when its dashed line is this dark and darker than the rest of the search
+const EDGE_DARKNESS = 0.3
+const EDGE_CONTRAST = 0.15
+
+// markPair is a point of the standardized document and the point of the photo it's found at
+type markPair struct {
+	doc, photo Point
+}
+
+// project applies the homography to the point
+func (m *Matrix) project(p Point) Point {
+	w := m.matrix[2][0]*p.x + m.matrix[2][1]*p.y + m.matrix[2][2]
+	return Point{
+		(m.matrix[0][0]*p.x + m.matrix[0][1]*p.y + m.matrix[0][2]) / w,
+		(m.matrix[1][0]*p.x + m.matrix[1][1]*p.y + m.matrix[1][2]) / w,
+	}
+}
+
+// solveLinearSystem solves a*x = b by Gaussian elimination, false is returned for a singular system
+func solveLinearSystem(a [][]float64, b []float64) ([]float64, bool) {
+	n := len(b)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < n; row++ {
+			k := a[row][col] / a[col][col]
+			for j := col; j < n; j++ {
+				a[row][j] -= k * a[col][j]
+			}
+			b[row] -= k * b[col]
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		x[row] = b[row]
+		for j := row + 1; j < n; j++ {
+			x[row] -= a[row][j] * x[j]
+		}
+		x[row] /= a[row][row]
+	}
+	return x, true
+}
+
+// fitHomography finds the homography from the document to the photo by least squares,
+// three pairs give an affine transformation, four and more give a full homography
+func fitHomography(pairs []markPair) (Matrix, bool) {
+	unknowns := 8
+	if len(pairs) < 4 {
+		unknowns = 6
+	}
+	if len(pairs) < 3 {
+		return Matrix{}, false
+	}
+	// coordinates are made about 1, so the system isn't ill-conditioned
+	const scale = DOC_SIZE
+	ata := make([][]float64, unknowns)
+	for i := range ata {
+		ata[i] = make([]float64, unknowns)
+	}
+	atb := make([]float64, unknowns)
+	addRow := func(row []float64, value float64) {
+		for i := 0; i < unknowns; i++ {
+			for j := 0; j < unknowns; j++ {
+				ata[i][j] += row[i] * row[j]
+			}
+			atb[i] += row[i] * value
+		}
+	}
+	for _, pair := range pairs {
+		x, y := pair.doc.x/scale, pair.doc.y/scale
+		u, v := pair.photo.x/scale, pair.photo.y/scale
+		addRow([]float64{x, y, 1, 0, 0, 0, -x * u, -y * u}[:unknowns], u)
+		addRow([]float64{0, 0, 0, x, y, 1, -x * v, -y * v}[:unknowns], v)
+	}
+	h, ok := solveLinearSystem(ata, atb)
+	if !ok {
+		return Matrix{}, false
+	}
+	if unknowns == 6 {
+		h = append(h, 0, 0)
+	}
+	return Matrix{matrix: [][]float64{
+		{h[0], h[1], h[2] * scale},
+		{h[3], h[4], h[5] * scale},
+		{h[6] / scale, h[7] / scale, 1},
+	}}, true
+}
+
+// markError is the distance in pixels of the document between the mark and the place the homography puts it
+func markError(inverse *Matrix, pair markPair) float64 {
+	return inverse.project(pair.photo).dist(pair.doc)
+}
+
+// keepsOrientation tells whether the whole document is in front of the camera, a homography turning
+// a part of it inside out is a wrong one
+func keepsOrientation(h *Matrix, width, height int) bool {
+	for _, corner := range []Point{{0, 0}, {float64(width), 0}, {0, float64(height)}, {float64(width), float64(height)}} {
+		if h.matrix[2][0]*corner.x+h.matrix[2][1]*corner.y+h.matrix[2][2] <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ransacHomography fits the homography to random quadruples of the marks and keeps the one most marks agree with,
+// then it's refitted to all of them, the first fixed marks are the fiducial squares which are always kept.
+// Inliers tell which marks agreed, the residual is the root mean square error of all marks, so a curled page
+// many marks disagree on is seen, an error is counted at most EDGE_SEARCH, so a single wrong edge isn't
+func ransacHomography(pairs []markPair, fixed, width, height int) (h Matrix, inliers []bool, residual float64, ok bool) {
+	// the random source is fixed, so a page is always read the same way
+	rng := rand.New(rand.NewSource(1))
+	countInliers := func(h *Matrix) ([]bool, int) {
+		inverse := getInverseMatrix(*h)
+		result := make([]bool, len(pairs))
+		count := 0
+		for i, pair := range pairs {
+			result[i] = i < fixed || markError(&inverse, pair) < RANSAC_INLIER_DISTANCE
+			if result[i] {
+				count++
+			}
+		}
+		return result, count
+	}
+	best := -1
+	if len(pairs) < 4 {
+		h, ok = fitHomography(pairs)
+		inliers, best = countInliers(&h)
+	}
+	for iteration := 0; iteration < RANSAC_ITERATIONS && len(pairs) >= 4; iteration++ {
+		sample := make([]markPair, 0, 4)
+		for _, i := range rng.Perm(len(pairs))[:4] {
+			sample = append(sample, pairs[i])
+		}
+		candidate, fitted := fitHomography(sample)
+		if !fitted || !keepsOrientation(&candidate, width, height) {
+			continue
+		}
+		candidateInliers, count := countInliers(&candidate)
+		if count > best {
+			h, inliers, best, ok = candidate, candidateInliers, count, true
+		}
+	}
+	if !ok {
+		return h, nil, 0, false
+	}
+	// the quadruple is refined by all marks that agree with it
+	for refit := 0; refit < 2; refit++ {
+		agreed := make([]markPair, 0, best)
+		for i, pair := range pairs {
+			if inliers[i] {
+				agreed = append(agreed, pair)
+			}
+		}
+		candidate, fitted := fitHomography(agreed)
+		if !fitted || !keepsOrientation(&candidate, width, height) {
+			break
+		}
+		h = candidate
+		inliers, best = countInliers(&h)
+	}
+	inverse := getInverseMatrix(h)
+	for _, pair := range pairs {
+		e := math.Min(markError(&inverse, pair), EDGE_SEARCH)
+		residual += e * e
+	}
+	return h, inliers, math.Sqrt(residual / float64(len(pairs))), true
+}
+
+func darkness(img *image.Gray, p Point) float64 {
+	x, y := int(p.x), int(p.y)
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return 0
+	}
+	return 1 - float64(img.GrayAt(x, y).Y)/255
+}
+
+// findEdge looks for the line from a to b of the document on the photo by moving it along the direction,
+// the shift in pixels of the document is returned
+func findEdge(img *image.Gray, h *Matrix, a, b, direction Point) (float64, bool) {
+	best, bestOffset, sum, steps := -1., 0., 0., 0.
+	for offset := -EDGE_SEARCH; offset <= EDGE_SEARCH; offset += 0.5 {
+		// the ends are left out, so the corners of crossing edges aren't counted
+		dark := 0.
+		samples := 0
+		for t := 0.1; t <= 0.9; t += 0.025 {
+			p := Point{a.x + t*(b.x-a.x) + offset*direction.x, a.y + t*(b.y-a.y) + offset*direction.y}
+			dark += darkness(img, h.project(p))
+			samples++
+		}
+		dark /= float64(samples)
+		if dark > best {
+			best, bestOffset = dark, offset
+		}
+		sum += dark
+		steps++
+	}
+	return bestOffset, best >= EDGE_DARKNESS && best-sum/steps >= EDGE_CONTRAST
+}
+
+// fieldCorners finds the corners of the dashed borders of the fields on the photo, they're the marks
+// the homography is fitted to besides the squares. The left edge of a field with a cancel box isn't looked for,
+// the box is nearer to it than EDGE_SEARCH
+func fieldCorners(img *image.Gray, layout *formLayout.Layout, h *Matrix, width, height int) []markPair {
+	marks := make([]markPair, 0, 4*len(layout.Fields))
+	for _, field := range layout.Fields {
+		x0, y0 := field.X*float64(width), field.Y*float64(height)
+		x1, y1 := (field.X+field.W)*float64(width), (field.Y+field.H)*float64(height)
+		top, topFound := findEdge(img, h, Point{x0, y0}, Point{x1, y0}, Point{0, 1})
+		bottom, bottomFound := findEdge(img, h, Point{x0, y1}, Point{x1, y1}, Point{0, 1})
+		left, leftFound := findEdge(img, h, Point{x0, y0}, Point{x0, y1}, Point{1, 0})
+		leftFound = leftFound && field.Cancel == nil
+		right, rightFound := findEdge(img, h, Point{x1, y0}, Point{x1, y1}, Point{1, 0})
+		add := func(found bool, x, y, dx, dy float64) {
+			if found {
+				marks = append(marks, markPair{Point{x, y}, h.project(Point{x + dx, y + dy})})
+			}
+		}
+		add(topFound && leftFound, x0, y0, left, top)
+		add(topFound && rightFound, x1, y0, right, top)
+		add(bottomFound && rightFound, x1, y1, right, bottom)
+		add(bottomFound && leftFound, x0, y1, left, bottom)
+	}
+	return marks
+}
+
+// resampleBilinear makes the document of the size by taking every its pixel from the photo through the homography,
+// colors between the pixels of the photo are interpolated
+func resampleBilinear(photo *image.RGBA, h *Matrix, width, height int) *image.RGBA {
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	bounds := photo.Bounds()
+	at := func(x, y, channel int) float64 {
+		if x < bounds.Min.X || y < bounds.Min.Y || x >= bounds.Max.X || y >= bounds.Max.Y {
+			return 255
+		}
+		return float64(photo.Pix[photo.PixOffset(x, y)+channel])
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := h.project(Point{float64(x) + 0.5, float64(y) + 0.5})
+			fx, fy := p.x-0.5, p.y-0.5
+			x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+			tx, ty := fx-float64(x0), fy-float64(y0)
+			var c [4]uint8
+			for channel := 0; channel < 4; channel++ {
+				value := at(x0, y0, channel)*(1-tx)*(1-ty) + at(x0+1, y0, channel)*tx*(1-ty) +
+					at(x0, y0+1, channel)*(1-tx)*ty + at(x0+1, y0+1, channel)*tx*ty
+				c[channel] = uint8(math.Round(value))
+			}
+			result.SetRGBA(x, y, color.RGBA{c[0], c[1], c[2], c[3]})
+		}
+	}
+	return result
+}
+
+// documentSize is the size of the standardized document of the layout, its longer side is DOC_SIZE
+func documentSize(layout *formLayout.Layout) (int, int) {
+	if layout.Width > layout.Height {
+		return DOC_SIZE, int(math.Round(DOC_SIZE * layout.Height / layout.Width))
+	}
+	return int(math.Round(DOC_SIZE * layout.Width / layout.Height)), DOC_SIZE
+}
@@ -0,0 +1,51 @@
+package fieldsRecognition
+
+import (
+	"image"
+	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
+)
+
+// pageToDocument maps a point of the layout to the standardized document by the centers of its squares
+func pageToDocument(layout *formLayout.Layout, x, y float64, corners [3]Point) (int, int) {
+	point := pageToDocumentPoint(layout, x, y, corners)
+	return int(point.x + 0.5), int(point.y + 0.5)
+}
+
+func pageToDocumentPoint(layout *formLayout.Layout, x, y float64, corners [3]Point) Point {
+	left, top := layout.Squares[0].Center()
+	right, bottom := layout.Squares[2].Center()
+	u := (x - left) / (right - left)
+	v := (y - top) / (bottom - top)
+	docX := corners[0].x + u*(corners[1].x-corners[0].x) + v*(corners[2].x-corners[1].x)
+	docY := corners[0].y + u*(corners[1].y-corners[0].y) + v*(corners[2].y-corners[1].y)
+	return Point{docX, docY}
+}
+
+// rectImage cuts the rectangle of the layout out of the document along its sides, so a field turned a bit is read as a straight one
+func rectImage(img *image.Gray, layout *formLayout.Layout, rect formLayout.Rect, corners [3]Point) *image.Gray {
+	topLeft := pageToDocumentPoint(layout, rect.X, rect.Y, corners)
+	width := int(topLeft.dist(pageToDocumentPoint(layout, rect.X+rect.W, rect.Y, corners)) + 0.5)
+	height := int(topLeft.dist(pageToDocumentPoint(layout, rect.X, rect.Y+rect.H, corners)) + 0.5)
+	result := image.NewGray(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	for i := 0; i < width; i++ {
+		for j := 0; j < height; j++ {
+			x, y := pageToDocument(layout, rect.X+rect.W*float64(i)/float64(width), rect.Y+rect.H*float64(j)/float64(height), corners)
+			result.SetGray(i, j, img.GrayAt(x, y))
+		}
+	}
+	return result
+}
+
+func fieldImage(img *image.Gray, layout *formLayout.Layout, field *formLayout.Field, corners [3]Point) *image.Gray {
+	return rectImage(img, layout, field.Rect, corners)
+}
+
+// saveFieldImages saves crops of the fields of the standardized document to src, readings are in the order of the layout,
+// the crops have the cancel boxes, so the teacher sees why an answer was cancelled
+func saveFieldImages(doc image.Image, layout *formLayout.Layout, corners [3]Point, readings []formLayout.FieldReading) {
+	img := imageToGrayScale(doc)
+	for i := range readings {
+		readings[i].Image = utils.SaveImageToSrc(rectImage(img, layout, layout.Fields[i].Outline(), corners))
+	}
+}
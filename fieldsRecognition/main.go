@@ -3,22 +3,23 @@ package fieldsRecognition
 import (
 	"errors"
 	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
 	"tucklejudge/fieldsRecognition/AI"
 	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn"
-	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn/metrics"
 	"fmt"
 	"github.com/gen2brain/go-fitz"
 	"golang.org/x/exp/constraints"
 	"image"
 	"image/color"
-	"image/jpeg"
 	_ "image/jpeg"
 	"image/png"
 	_ "image/png"
 	"math"
 	"math/rand"
 	"os"
+	"runtime"
 	"sort"
+	"strings"
 )
 
 const pixel = 1
@@ -186,40 +187,58 @@ func printImage(filepath string, img image.Image) {
 	_ = png.Encode(f, img)
 }
 
-func getImagesFromPdf(filepath string) ([]image.Image, error) {
-	doc, err := fitz.New(filepath)
-	if err != nil {
-		return nil, err
-	}
-	defer doc.Close()
-	images := make([]image.Image, doc.NumPage())
-	for i := 0; i < doc.NumPage(); i++ {
-		images[i], err = doc.Image(i)
-		if err != nil {
-			return nil, err
-		}
+// limits of uploads, they're changed by SetUploadLimits before checks are started
+var pdfDPI = 300.0
+var maxPages = 200
+var maxPagePixels = 50000000 // A4 at 600 DPI is about 35 million pixels
+
+// a page is rasterized at this DPI first to learn its size without rendering it in full
+const PROBE_DPI = 18.0
+
+// SetUploadLimits sets the DPI PDF pages are rendered at, the most pages of an upload and the most pixels of a page
+func SetUploadLimits(dpi float64, pages, pagePixels int) {
+	pdfDPI = dpi
+	maxPages = pages
+	maxPagePixels = pagePixels
+}
+
+func checkPixels(width, height int) error {
+	if width*height > maxPagePixels {
+		return pageError(ErrTooLarge, "the page is %dx%d pixels, at most %d pixels are allowed", width, height, maxPagePixels)
 	}
-	return images, nil
+	return nil
 }
 
-func getImageFromPNG(filepath string) (image.Image, error) {
-	f, err := os.Open(filepath)
+// openPdf opens an uploaded PDF, the pages are rasterized one by one with renderPdfPage
+func openPdf(filepath string) (*fitz.Document, error) {
+	doc, err := fitz.New(filepath)
 	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	err = checkPageCount(doc.NumPage())
+	if err != nil {
+		doc.Close()
 		return nil, err
 	}
-	defer f.Close()
-	image, err := png.Decode(f)
-	return image, err
+	return doc, nil
 }
 
-func getImageFromJPEG(filepath string) (image.Image, error) {
-	f, err := os.Open(filepath)
+// renderPdfPage rasterizes one page at the configured DPI, a page above the pixel limit isn't rendered
+func renderPdfPage(doc *fitz.Document, page int) (image.Image, error) {
+	probe, err := doc.ImageDPI(page, PROBE_DPI)
+	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	scale := pdfDPI / PROBE_DPI
+	err = checkPixels(int(float64(probe.Bounds().Dx())*scale), int(float64(probe.Bounds().Dy())*scale))
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
-	image, err := jpeg.Decode(f)
-	return image, err
+	img, err := doc.ImageDPI(page, pdfDPI)
+	if err != nil {
+		return nil, pageError(ErrUnreadableImage, "%s", err.Error())
+	}
+	return img, nil
 }
 
 func imageToGrayScale(img image.Image) *image.Gray {
@@ -530,24 +549,6 @@ func (m *Matrix) D3multToInt(arr []float64) (result []int) {
 	return result
 }
 
-func perspectiveTransformation(init image.Image, x, y float64) *image.RGBA {
-	m := Matrix{matrix: [][]float64{
-		[]float64{1, 0, 0},
-		[]float64{0, 1, 0},
-		[]float64{0, -0.003 * y, 1},
-	}}
-	m = getInverseMatrix(m)
-	img := image.NewRGBA(init.Bounds())
-	for i := img.Bounds().Min.X; i <= img.Bounds().Max.X; i++ {
-		for j := img.Bounds().Min.Y; j <= img.Bounds().Max.Y; j++ {
-			newCords := m.D3multToInt([]float64{float64(i), float64(j), 1.})
-			img.Set(i, j, init.At(newCords[0], newCords[1]))
-		}
-	}
-	//printImage("PerspectiveNotAffine.png", img)
-	return img
-}
-
 func resizeImage(init image.Image, a, b int) *image.RGBA {
 	img := image.NewRGBA(image.Rect(0, 0, a, b))
 	for i := init.Bounds().Min.X; i <= init.Bounds().Max.X; i++ {
@@ -558,7 +559,10 @@ func resizeImage(init image.Image, a, b int) *image.RGBA {
 	return img
 }
 
-func photoToStandardDocument(init image.Image) (result *image.RGBA) {
+// photoToStandardDocument chooses the layout of the sheet among the layouts by the squares, it also returns
+// centers of the top left, top right and bottom right squares on the result and the residual error
+// of the homography, a big one means the photo is distorted in a way the homography can't straighten
+func photoToStandardDocument(init image.Image, layouts []*formLayout.Layout, trace *debugTrace) (result *image.RGBA, corners [3]Point, layout *formLayout.Layout, residual float64, err error) {
 	// making image twice smaller
 	var pic *image.RGBA
 	{
@@ -577,12 +581,14 @@ func photoToStandardDocument(init image.Image) (result *image.RGBA) {
 				pic.Set(i, j, smallerImage.At(i, j))
 			}
 		}
+		trace.transform("scale %dx%d to %dx%d", init.Bounds().Dx(), init.Bounds().Dy(), pic.Bounds().Dx(), pic.Bounds().Dy())
 	}
 
 	// looking for squares
 	squares := squaresRecognition(pic)
+	trace.foundSquares(pic, squares)
 	if len(squares) != 3 {
-		panic(errors.New(fmt.Sprintf("Picture has %d helping squares, should be 3", len(squares))))
+		return nil, corners, nil, 0, pageError(ErrNoFiducials, "picture has %d helping squares, should be 3", len(squares))
 	}
 
 	// finding squares centers
@@ -599,142 +605,73 @@ func photoToStandardDocument(init image.Image) (result *image.RGBA) {
 		centers[i] = Point{meanX, meanY}
 	}
 
-	// repositioning legs and hypotenuse
-	a := centers[0].vect(centers[1])
-	b := centers[0].vect(centers[2])
-	c := centers[1].vect(centers[2])
-	if centers[0].dist(centers[1]) > centers[0].dist(centers[2]) && centers[0].dist(centers[1]) > centers[1].dist(centers[2]) {
-		a = centers[2].vect(centers[0])
-		b = centers[2].vect(centers[1])
-		c = centers[0].vect(centers[1])
-	} else if centers[0].dist(centers[2]) > centers[1].dist(centers[2]) && centers[0].dist(centers[2]) > centers[0].dist(centers[1]) {
-		a = centers[1].vect(centers[0])
-		b = centers[1].vect(centers[2])
-		c = centers[0].vect(centers[2])
-	}
-
-	// sorting sides a.len() < b.len() < c.len()
-	if a.len > b.len && a.len < c.len {
-		a, b = b, a
-	} else if a.len < b.len && b.len > c.len {
-		if c.len > a.len {
-			b, c = c, b
-		} else {
-			a, b, c = c, a, b
-		}
-	} else if a.len > b.len && a.len > c.len {
-		if c.len > b.len {
-			a, b, c = b, c, a
-		} else {
-			a, b, c = c, b, a
+	// the top right square is at the right angle, the top left one is chosen so the page isn't mirrored
+	right := 0
+	for i := range centers {
+		if centers[(i+1)%3].dist(centers[(i+2)%3]) > centers[(right+1)%3].dist(centers[(right+2)%3]) {
+			right = i
 		}
 	}
-
-	// making STANDARD larger canvas for image TODO: rectify coz it's redundant
-	canvas := image.NewRGBA(image.Rect(0, 0, DOC_SIZE, DOC_SIZE))
-	for i := pic.Bounds().Min.X; i <= pic.Bounds().Max.X; i++ {
-		for j := pic.Bounds().Min.Y; j <= pic.Bounds().Max.Y; j++ {
-			canvas.Set(i, j, pic.At(i, j))
-		}
+	topLeft, topRight, bottomRight := centers[(right+1)%3], centers[right], centers[(right+2)%3]
+	if topLeft.vect(topRight).crossProduct(topRight.vect(bottomRight)) < 0 {
+		topLeft, bottomRight = bottomRight, topLeft
 	}
 
-	// rotating image to make OX parallel to one of the sides
-	{
-		OX := Vector{
-			dx:  1,
-			dy:  0,
-			len: 1,
+	// the layout is chosen among the ones of the same orientation by the ratio of the legs
+	horizontal, vertical := topLeft.dist(topRight), topRight.dist(bottomRight)
+	oriented := make([]*formLayout.Layout, 0, len(layouts))
+	for _, l := range layouts {
+		if l.Landscape() == (horizontal > vertical) {
+			oriented = append(oriented, l)
 		}
-		cos := math.Abs(a.cosBetween(OX))
-		sin := math.Sqrt(1 - cos*cos)
-		transformation := generateAffineMatrixFor2DCords(
-			cos, sin, 0,
-			-sin, cos, 0,
-		)
-		canvas = applyAffineTransformation(canvas, transformation)
 	}
-
-	// rotating image to make a and b perpendicular TODO: redundant if we have perspective transformation
-	{
-		sin := a.cosBetween(b)        // sin(90-A) = cos(A)
-		cos := math.Sqrt(1 - sin*sin) // cos(90-A)
-		tg := sin / cos
-		transformation := generateAffineMatrixFor2DCords(
-			1, tg, -DOC_SIZE*tg,
-			0, 1, 0,
-		)
-		canvas = applyAffineTransformation(canvas, transformation)
+	if len(oriented) == 0 {
+		oriented = layouts
 	}
+	layout = formLayout.ChooseLayout(oriented, math.Max(horizontal, vertical)/math.Min(horizontal, vertical))
+	trace.transform("choose layout %s by the ratio of the legs %.3f", layout.Name, math.Max(horizontal, vertical)/math.Min(horizontal, vertical))
 
-	// perspective transformation
-	{
-		sin := a.cosBetween(b) // sin(90-A) = cos(A)
-		//cos := math.Sqrt(1 - sin*sin) // cos(90-A)
-		//tx := cos
-		ty := sin
-		canvas = perspectiveTransformation(canvas, 0, ty)
+	// the document is the whole page, the squares are put where the layout has them
+	width, height := documentSize(layout)
+	for i, square := range layout.Squares {
+		x, y := square.Center()
+		corners[i] = Point{x * float64(width), y * float64(height)}
 	}
+	marks := []markPair{{corners[0], topLeft}, {corners[1], topRight}, {corners[2], bottomRight}}
 
-	// if picture is flipped it should be reversed
-	{
-		if b.dy < 0 {
-			canvas = Flip(canvas)
+	// the squares give an affine transformation, the corners of the fields found with it give a full homography,
+	// which is found again with the better estimate, so the fields are found on strongly distorted photos as well
+	homography, _ := fitHomography(marks)
+	gray := imageToGrayScale(pic)
+	var inliers []bool
+	found := marks
+	for pass := 0; pass < 2; pass++ {
+		found = append(marks[:3:3], fieldCorners(gray, layout, &homography, width, height)...)
+		h, agreed, r, ok := ransacHomography(found, 3, width, height)
+		if !ok {
+			break
 		}
+		homography, inliers, residual = h, agreed, r
 	}
-
-	// adjust picture so (0,0) pixel is the middle of the left above square
-	{
-		// finding squares again
-		squares = squaresRecognition(canvas)
-		if len(squares) != 3 {
-			panic(errors.New(fmt.Sprintf("Picture has %d helping squares, should be 3", len(squares))))
-		}
-		centers := make([]Point, 3)
-		for i, comp := range squares {
-			meanX := 0.
-			meanY := 0.
-			for _, point := range comp {
-				meanX += float64(point.first)
-				meanY += float64(point.second)
-			}
-			meanX /= float64(len(comp))
-			meanY /= float64(len(comp))
-			centers[i] = Point{meanX, meanY}
-		}
-		zeroPoint := centers[0]
-		shift := int(min(min(centers[0].x-1, centers[0].y-1), math.Sqrt(float64(len(squares[0])))))
-		if centers[1].x < zeroPoint.x {
-			zeroPoint = centers[1]
-			shift = int(min(min(centers[1].x-1, centers[1].y-1), math.Sqrt(float64(len(squares[1])))))
-		}
-		if centers[2].x < zeroPoint.x {
-			zeroPoint = centers[2]
-			shift = int(min(min(centers[2].x-1, centers[2].y-1), math.Sqrt(float64(len(squares[2])))))
+	if inliers == nil {
+		inliers = make([]bool, len(found))
+		for i := range inliers {
+			inliers[i] = true
 		}
-		transformation := generateAffineMatrixFor2DCords(
-			1, 0, zeroPoint.x-float64(shift),
-			0, 1, zeroPoint.y-float64(shift),
-		)
-		canvas = applyAffineTransformation(canvas, transformation)
-
-		dx := 0
-		dy := 0
-		if zeroPoint == centers[1] {
-			centers[0], centers[1] = centers[1], centers[0]
-		} else if zeroPoint == centers[2] {
-			centers[0], centers[2] = centers[2], centers[0]
-		}
-		dx = max(int(centers[2].x-centers[0].x), int(centers[1].x-centers[0].x)) + int(math.Sqrt(float64(len(squares[1]))))/2 + shift
-		dy = max(int(centers[1].y-centers[0].y), int(centers[2].y-centers[0].y)) + int(math.Sqrt(float64(len(squares[2]))))/2 + shift
-
-		result = image.NewRGBA(image.Rect(0, 0, dx, dy))
-		for i := 0; i < dx; i++ {
-			for j := 0; j < dy; j++ {
-				result.Set(i, j, canvas.At(i, j))
-			}
+	}
+	agreed := 0
+	for _, inlier := range inliers {
+		if inlier {
+			agreed++
 		}
 	}
-	return result
+	trace.transform("homography to the photo %s is fitted to %d of %d marks, %d corners of fields are found",
+		matrixString(&homography), agreed, len(found), len(found)-3)
+	trace.transform("residual error is %.2f pixels, at most %.1f is trusted", residual, MAX_RESIDUAL)
+
+	result = resampleBilinear(pic, &homography, width, height)
+	trace.marks(result, &homography, found, inliers)
+	return result, corners, layout, residual, nil
 }
 
 func diminishWhiteFiguresThickness(init *image.Gray) *image.Gray {
@@ -1171,7 +1108,8 @@ func imageFragmentTo28x28cnnVersion(rec image.Rectangle, init *image.Gray) (resu
 			}
 			return whiteCount
 		}
-		for getPureWhites() < 100 {
+		// faint ink never gets pure white, so it's thickened as much as the image size at most
+		for i := 0; getPureWhites() < 100 && i < 28; i++ {
 			img = augmentWhiteFiguresThickness(img)
 		}
 	}
@@ -1273,7 +1211,8 @@ func imageFragmentTo28x28PerceptronVersion(rec image.Rectangle, init *image.Gray
 		//for getPureWhites() > 200 {
 		//	img = diminishWhiteFiguresThickness(img)
 		//}
-		for getPureWhites() < 100 {
+		// faint ink never gets pure white, so it's thickened as much as the image size at most
+		for i := 0; getPureWhites() < 100 && i < 28; i++ {
 			img = augmentWhiteFiguresThickness(img)
 		}
 	}
@@ -1692,127 +1631,164 @@ func fieldsRecognizer(img *image.Gray, kernelX, kernelY, minimumFieldSize int) (
 	return components
 }
 
-var perceptrons = AI.InitializePerceptronMesh()
-var NN *cnn.Network
+var perceptrons [10]*AI.Perceptron // loaded by LoadNetwork
 
-func formValuesProcessing(init image.Image) (results []string, outputImage *image.Gray) {
-	outputImage = imageToGrayScale(init)
-	if !PERCEPTRON {
-		NN = cnn.New([]int{28, 28}, 0.005, &metrics.CrossEntropyLoss{})
-		//NN.LoadConvolutionLayer([]int{3, 3}, 8).
-		//	AddMaxPoolingLayer(2, []int{2, 2}).
-		//	LoadFullyConnectedLayer(10). // 0-9
-		//	AddSoftmaxLayer()
-
-		//NN.LoadFullyConnectedLayer(10). // 0-9
-		//	AddSoftmaxLayer()
-
-		//NN.LoadFullyConnectedLayer(10).
-		//	AddReLULayer().
-		//	LoadFullyConnectedLayer(10). // 0-9
-		//	AddSoftmaxLayer()
-
-		NN.LoadConvolutionLayer([]int{3, 3}, 10).
-			AddMaxPoolingLayer(5, []int{4, 4}).
-			LoadFullyConnectedLayer(10). // 0-9
-			AddSoftmaxLayer()
-
-		//NN.LoadConvolutionLayer([]int{3, 3}, 10).
-		//	AddMaxPoolingLayer(5, []int{4, 4}).
-		//	LoadFullyConnectedLayer(10).
-		//	AddReLULayer().
-		//	LoadFullyConnectedLayer(10). // 0-9
-		//	AddSoftmaxLayer()
-	}
-	// recognizing fields
-	img := imageToGrayScale(init)
-	inverseGray(img)
-	diminishBlackGradient(img)
-	otsuThreshold(img)
-	noiseDecrease(img)
-	printImage("kek.png", img)
+// a pixel of the inverted field is ink when it's brighter than INK_LEVEL, a cell is blank when less than BLANK_INK
+// of the middle of it is ink, a stroke of a digit covers several times more
+const INK_LEVEL = 128
+const BLANK_INK = 0.02
 
-	imgSize := (img.Bounds().Max.X - img.Bounds().Min.X + 1) * (img.Bounds().Max.Y - img.Bounds().Min.Y + 1)
-	fields := fieldsRecognizer(img, int(float64(img.Bounds().Max.X-img.Bounds().Min.X+1)/85.), int(float64(img.Bounds().Max.X-img.Bounds().Min.Y+1)/100.), int(float64(imgSize)*0.01))
+// blankConfidence is how sure it is that a cell with this part of its middle covered with ink is blank,
+// specks of dirt and of the erased rules are common, so it's doubted only near BLANK_INK
+func blankConfidence(ink float64) float64 {
+	return math.Min(1, math.Max(0, 2-2*ink/BLANK_INK))
+}
 
-	// backup of a noisy image
-	img = imageToGrayScale(init)
+// cellInk is the part of the middle of the cell covered with ink, the sixths at the sides are left out,
+// so the dividers and the border of the field aren't counted
+func cellInk(rect image.Rectangle, img *image.Gray) float64 {
+	return middleInk(rect, img, 1./6)
+}
+// formValuesProcessing reads the fields declared by the layout, readings are in the order of the layout fields
+func formValuesProcessing(init image.Image, layout *formLayout.Layout, corners [3]Point, trace *debugTrace) (results []formLayout.FieldReading, outputImage *image.Gray) {
+	outputImage = imageToGrayScale(init)
+	img := imageToGrayScale(init)
 	inverseGray(img)
 
-	for fieldID, field := range fields {
+	for i := range layout.Fields {
+		field := &layout.Fields[i]
 		currentValue := ""
-		if len(field) == 0 {
-			continue
+		reading := formLayout.FieldReading{Role: field.Role, Question: field.Question, Confidence: 1}
+		// the processed image is painted over the bounds of the field
+		minX, minY := pageToDocument(layout, field.X, field.Y, corners)
+		maxX, maxY := pageToDocument(layout, field.X+field.W, field.Y+field.H, corners)
+		// the printed rules are read as 1s and 7s, so they're erased before the digits are looked for
+		fieldImg := removeRules(fieldImage(img, layout, field, corners), field)
+		trace.field(layout, field, corners)
+		width, height := fieldImg.Bounds().Dx(), fieldImg.Bounds().Dy()
+		blocks := field.Cells
+		borders := int(float64(height) * field.Margin)
+		dx := int(math.Round(float64(width) / float64(blocks)))
+		segments := segmentField(fieldImg, field)
+		leftover := leftoverInk(fieldImg, segments)
+		// every digit written is read in its own window, a cell of the grid with no digit in it is blank,
+		// a free-form field has no cells, so it's only the digits
+		type fieldItem struct {
+			cell int
+			rect image.Rectangle
+			source *image.Gray
+			written bool
+		}
+		items := make([]fieldItem, 0, blocks)
+		next := 0
+		for block := 0; block < blocks && !field.FreeForm; block++ {
+			if next == len(segments) || segments[next].cell != block {
+				blockRect := image.Rect(dx*block+borders, borders, dx*(block+1)-1-borders/2, height-borders)
+				items = append(items, fieldItem{block, blockRect, leftover, false})
+			}
+			for ; next < len(segments) && segments[next].cell == block; next++ {
+				items = append(items, fieldItem{block, segments[next].window, segments[next].img, true})
+			}
 		}
-		minX := img.Bounds().Max.X
-		maxX := 0
-		minY := img.Bounds().Max.Y
-		maxY := 0
-		for _, v := range field {
-			minX = min(minX, v.first)
-			maxX = max(maxX, v.first+1)
-			minY = min(minY, v.second)
-			maxY = max(maxY, v.second+1)
-		}
-		blocks := 8
-		borders := int(float64(maxY-minY) / 6.)
-		if fieldID < 2 {
-			blocks = 4
-			borders = int(float64(maxY-minY) / 15.)
-		}
-		dx := int(math.Round(float64(maxX-minX) / float64(blocks)))
-		for block := 0; block < blocks; block++ {
-			start := minX + dx*block
-			finish := minX + dx*(block+1)
+		for k := 0; k < len(segments) && field.FreeForm; k++ {
+			items = append(items, fieldItem{k, segments[k].window, segments[k].img, true})
+		}
+		for _, item := range items {
+			start := minX + item.rect.Min.X*(maxX-minX)/width
+			finish := minX + item.rect.Max.X*(maxX-minX)/width
 			digit := 10
-			blockRect := image.Rect(start+borders, minY+borders, finish-1-borders/2, maxY-borders)
-
-			// digits is an array of all possible digits dedicated to a current image
-			digits := AI.GetAnalyticsPrediction(imageFragmentTo28x28AnalyticsVersion(blockRect, img, true))
-
-			// getting predictions
-			predictions := make([]int, 0)
-			if PERCEPTRON {
-				predictions = AI.GetPrediction(imageFragmentTo28x28PerceptronVersion(blockRect, img), perceptrons)
-			} else {
-				predictions = NN.GetDigitPredictionFromImageArray([]int{28, 28}, imageFragmentTo28x28cnnVersion(blockRect, img))
-				//predictions = NN.GetDigitPredictionFromImageArray([]int{28, 28}, imageFragmentTo28x28cnnVersion(image.Rect(start+int(2*float64(borders)), minY+borders, finish-1, maxY-borders), img))
+			blockRect := item.rect
+
+			// blank cells aren't given to the classifiers, the less ink is left in a blank cell the surer it's blank
+			cell := formLayout.CellReading{Digit: digit, Confidence: blankConfidence(cellInk(blockRect, item.source))}
+			var digits []int
+			void, doubtful := false, false
+			if item.written {
+				void, doubtful = crossedOut(blockRect, item.source)
 			}
+			if void {
+				// the crossed out digit isn't read, its correction is written next to it
+				cell = formLayout.CellReading{Digit: digit, Void: true, Confidence: 1}
+			} else if item.written {
+				// digits is an array of all possible digits dedicated to a current image
+				digits = AI.GetAnalyticsPrediction(imageFragmentTo28x28AnalyticsVersion(blockRect, item.source, true))
+
+				// getting predictions
+				predictions := make([]int, 0)
+				var probabilities []float64
+				if PERCEPTRON {
+					predictions = AI.GetPrediction(imageFragmentTo28x28PerceptronVersion(blockRect, item.source), perceptrons)
+				} else {
+					probabilities = digitProbabilities(imageFragmentTo28x28cnnVersion(blockRect, item.source))
+					predictions = cnn.DigitsByProbability(probabilities)
+					//predictions = NN.GetDigitPredictionFromImageArray([]int{28, 28}, imageFragmentTo28x28cnnVersion(image.Rect(start+int(2*float64(borders)), minY+borders, finish-1, maxY-borders), img))
+				}
 
-			// matching predictions and digits
-			for _, x := range predictions {
-				ok := false
-				for _, y := range digits {
-					if x == y {
-						ok = true
+				// matching predictions and digits
+				for _, x := range predictions {
+					ok := false
+					for _, y := range digits {
+						if x == y {
+							ok = true
+						}
+					}
+					if ok {
+						digit = x
+						break
 					}
 				}
-				if ok {
-					digit = x
-					break
+
+				cell = formLayout.CellReading{Digit: digit, Probabilities: probabilities, Confidence: 1}
+				if digit == 10 {
+					// ink that isn't any digit
+					cell.Confidence = 0
+				} else if probabilities != nil {
+					cell.Confidence = probabilities[digit]
+				}
+				if doubtful {
+					// the digit may be crossed out
+					cell.Confidence = 0
 				}
 			}
 
 			if DEBUG {
 				fmt.Print(digit, " ")
 			}
+			reading.Cells = append(reading.Cells, cell)
+			trace.cell(layout, field, corners, item.source, blockRect, item.cell, digits, cell)
+			reading.Confidence = math.Min(reading.Confidence, cell.Confidence)
 			// MaybeInFuture: fillFragmentToImage(image.Rect(start, minY, finish, maxY+1), imageOfDigit[digit])
 			for i := start; i < finish; i++ {
 				for j := minY; j <= maxY; j++ {
 					outputImage.SetGray(i, j, color.Gray{Y: 10*uint8(digit)})
 				}
 			}
-			if digit == 10 { // TODO CRINGE FIX PLEASE CAN'T STAND
-				digit = 0
+			if cell.Void {
+				continue
 			}
-			if digit != 10 {
+			if digit == 10 {
+				currentValue += formLayout.BLANK_CELL
+			} else {
 				currentValue += string(rune(digit + '0'))
 			}
 			//if block == 3 && fieldID == 4 {
 			//	return
 			//}
 		}
-		results = append(results, currentValue)
+		reading.Value = strings.TrimRight(currentValue, formLayout.BLANK_CELL)
+		if field.Cancel != nil {
+			ticked, confidence, ink := cancelTicked(img, layout, field, corners)
+			trace.cancel(layout, field, corners, ink)
+			// whatever is written in a cancelled field doesn't matter
+			if ticked {
+				reading.Value = ""
+				reading.Confidence = confidence
+			} else {
+				reading.Confidence = math.Min(reading.Confidence, confidence)
+			}
+			reading.Cancelled = ticked
+		}
+		results = append(results, reading)
 		if DEBUG {
 			fmt.Println()
 		}
@@ -1822,40 +1798,109 @@ func formValuesProcessing(init image.Image) (results []string, outputImage *imag
 	return results, outputImage
 }
 
-func BringTestResultsFromPhoto(filepath string, ext string) (results, images []string) {
-	var img image.Image
-	if ext == "jpeg" {
-		img, _ = getImageFromJPEG(filepath)
-	} else if ext == "png" {
-		img, _ = getImageFromPNG(filepath)
-	} else {
-		img, _ = getImageFromJPEG(filepath)
+// PageResult is what was read from one page, Err is a *PageError when the page wasn't read
+type PageResult struct {
+	Values *formLayout.Values
+	InputImage string // names of the images saved to src folder
+	NormalizedImage string
+	ProcessedImage string
+	Err error
+	Residual float64 // how far in pixels the marks of the page are from where the homography puts them
+	Debug *utils.DebugBundle // set when the page is debugged, it isn't saved yet
+}
+
+// readSheet reads the standardized document, values of the sheet code are more reliable than handwritten ones
+func readSheet(doc image.Image, layout *formLayout.Layout, corners [3]Point, trace *debugTrace) (values *formLayout.Values, outputImage *image.Gray) {
+	readings, outputImage := formValuesProcessing(doc, layout, corners, trace)
+	trace.document(doc)
+	values = formLayout.Collect(readings)
+	code, err := readSheetCode(doc, layout, corners)
+	if err == nil {
+		applySheetCode(values, code)
+	}
+	return values, outputImage
+}
+
+// checkIDs makes sure that the student and the test of the sheet exist
+func checkIDs(values *formLayout.Values) error {
+	_, err := utils.GetTestByID(values.TestID)
+	if err != nil {
+		return pageError(ErrUnknownTest, "test %s was read", values.TestID)
+	}
+	_, err = utils.GetUsernameByID(values.UserID)
+	if err != nil {
+		return pageError(ErrUnknownStudent, "student %s was read", values.UserID)
 	}
+	return nil
+}
+
+// readPage recognizes one page, a panic of recognition spoils only the page,
+// the debug bundle tells what every stage decided, it's made for failed pages as well
+func readPage(img image.Image, layouts []*formLayout.Layout, debug bool) (page PageResult) {
+	var trace *debugTrace
+	defer func() {
+		if r := recover(); r != nil {
+			page.Err = pageError(ErrUnreadableImage, "recognition failed: %v", r)
+		}
+		if trace != nil {
+			trace.fail(page.Err)
+			page.Debug = trace.bundle
+		}
+	}()
 	// saving initial imge to src folder
-	images = []string{utils.SaveImageToSrc(img), ""}
+	page.InputImage = utils.SaveImageToSrc(img)
+	if debug {
+		trace = newDebugTrace(page.InputImage)
+	}
 	// preprocessing image
-	img = photoToStandardDocument(img)
+	doc, corners, layout, residual, err := photoToStandardDocument(img, layouts, trace)
+	if err != nil {
+		page.Err = err
+		return page
+	}
+	page.Residual = residual
 	// calculating results
-	results, img = formValuesProcessing(img)
+	values, processed := readSheet(doc, layout, corners, trace)
 	// saving processed imge to src folder
-	images[1] = utils.SaveImageToSrc(img)
-	return results, images
-}
-
-func BringTestResultsFromPDFs(filepath string) (results, images [][]string) {
-	imgs, _ := getImagesFromPdf(filepath)
-	for _, img := range imgs {
-		// saving initial imge to src folder
-		images = append(images, []string{utils.SaveImageToSrc(img), ""})
-		// preprocessing image
-		img = photoToStandardDocument(img)
-		// calculating results
-		current_results, img := formValuesProcessing(img)
-		results = append(results, current_results)
-		// saving processed imge to src folder
-		images[len(images)-1][1] = utils.SaveImageToSrc(img)
-	}
-	return results, images
+	page.ProcessedImage = utils.SaveImageToSrc(processed)
+	// the sheet and its fields are kept to be reviewed
+	page.NormalizedImage = utils.SaveImageToSrc(doc)
+	saveFieldImages(doc, layout, corners, values.Fields)
+	page.Values = values
+	page.Err = checkIDs(values)
+	return page
+}
+
+// pages being recognized at the same time by all checks, a page takes a slot while it's read
+var pageSlots = make(chan struct{}, runtime.NumCPU())
+
+// SetPageWorkers changes the number of pages recognized at the same time, it's called before checks are started
+func SetPageWorkers(workers int) {
+	pageSlots = make(chan struct{}, max(workers, 1))
+}
+
+// withPageSlot waits for a free slot and reads the page
+func withPageSlot(read func()) {
+	slots := pageSlots
+	slots <- struct{}{}
+	defer func() { <-slots }()
+	read()
+}
+
+// getLayouts returns the layout of the name or all of them when the name is empty, so it's chosen by the squares
+func getLayouts(layoutName string) ([]*formLayout.Layout, error) {
+	if layoutName == "" {
+		layouts, err := formLayout.GetLayouts()
+		if err == nil && len(layouts) == 0 {
+			err = errors.New("There are no layouts in " + formLayout.LAYOUTS_FOLDER)
+		}
+		return layouts, err
+	}
+	layout, err := formLayout.GetLayout(layoutName)
+	if err != nil {
+		return nil, err
+	}
+	return []*formLayout.Layout{layout}, nil
 }
 
 // func main() {
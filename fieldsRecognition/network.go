@@ -0,0 +1,105 @@
+package fieldsRecognition
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"tucklejudge/fieldsRecognition/AI"
+	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn"
+	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn/metrics"
+	"tucklejudge/utils"
+)
+
+const NETWORK_WEIGHTS_FOLDER = "fieldsRecognition/networkWeights"
+
+// network is shared by all pages, new weights replace the whole network
+var network *cnn.Network
+var networkMutex sync.RWMutex
+
+func newNetwork() (*cnn.Network, error) {
+	result := cnn.New([]int{28, 28}, 0.005, &metrics.CrossEntropyLoss{})
+	//result.AddConvolutionLayer([]int{3, 3}, 8).
+	//	AddMaxPoolingLayer(2, []int{2, 2}).
+	//	AddFullyConnectedLayer(10). // 0-9
+	//	AddSoftmaxLayer()
+
+	//result.AddFullyConnectedLayer(10). // 0-9
+	//	AddSoftmaxLayer()
+
+	//result.AddFullyConnectedLayer(10).
+	//	AddReLULayer().
+	//	AddFullyConnectedLayer(10). // 0-9
+	//	AddSoftmaxLayer()
+
+	result.AddConvolutionLayer([]int{3, 3}, 10).
+		AddMaxPoolingLayer(5, []int{4, 4}).
+		AddFullyConnectedLayer(10). // 0-9
+		AddSoftmaxLayer()
+
+	//result.AddConvolutionLayer([]int{3, 3}, 10).
+	//	AddMaxPoolingLayer(5, []int{4, 4}).
+	//	AddFullyConnectedLayer(10).
+	//	AddReLULayer().
+	//	AddFullyConnectedLayer(10). // 0-9
+	//	AddSoftmaxLayer()
+	err := result.LoadWeights(NETWORK_WEIGHTS_FOLDER)
+	if err != nil {
+		result.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+// the perceptrons are loaded with the first network, debug bundles compare them with it, their weights aren't reloaded
+var loadPerceptronsOnce sync.Once
+
+// LoadNetwork loads the weights at startup and swaps in new ones later, pages being read finish with the old weights
+func LoadNetwork() error {
+	loadPerceptronsOnce.Do(func() {
+		perceptrons = AI.InitializePerceptronMesh()
+	})
+	if PERCEPTRON {
+		return nil
+	}
+	loaded, err := newNetwork()
+	if err != nil {
+		return err
+	}
+	networkMutex.Lock()
+	old := network
+	network = loaded
+	networkMutex.Unlock()
+	// nobody predicts with the old network after the swap
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// digitProbabilities are predicted by the shared network
+func digitProbabilities(img []int) []float64 {
+	networkMutex.RLock()
+	defer networkMutex.RUnlock()
+	if network == nil {
+		panic("network isn't loaded")
+	}
+	return network.GetDigitProbabilitiesFromImageArray([]int{28, 28}, img)
+}
+
+// ReloadNetworkHandler swaps in the weights saved to fieldsRecognition/networkWeights without a restart
+func ReloadNetworkHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if utils.CheckForAdmin(r) == false {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	err := LoadNetwork()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Println("Recognition network is reloaded")
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -8,7 +8,6 @@ import (
 	"image/png"
 	"math"
 	"os"
-	"runtime"
 )
 
 type ConvolutionLayer struct {
@@ -20,12 +19,11 @@ type ConvolutionLayer struct {
 
 	iteration int
 
-	jobs    chan job
-	results chan result
+	pool *WorkerPool // filters are applied by the pool in Infer
 }
 
-func NewConvolutionLayer(filterDimensionSizes []int, depth int, inputDims []int) *ConvolutionLayer {
-	conv := &ConvolutionLayer{}
+func NewConvolutionLayer(filterDimensionSizes []int, depth int, inputDims []int, pool *WorkerPool) *ConvolutionLayer {
+	conv := &ConvolutionLayer{pool: pool}
 	conv.filterDimensionSizes = filterDimensionSizes
 	for len(conv.filterDimensionSizes) < len(inputDims) {
 		conv.filterDimensionSizes = append(conv.filterDimensionSizes, 1)
@@ -42,13 +40,6 @@ func NewConvolutionLayer(filterDimensionSizes []int, depth int, inputDims []int)
 
 	conv.outputDimensions = append(conv.ccMapSize, depth)
 
-	conv.jobs = make(chan job, 1000)
-	conv.results = make(chan result, 1000)
-
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go worker(conv.jobs, conv.results)
-	}
-
 	//n, err := conv.SaveFiltersAsImages("./filters")
 	//if err != nil {
 	//	panic(err)
@@ -65,22 +56,6 @@ func (conv *ConvolutionLayer) SaveInfo() string {
 	return conv.filters.SaveTensor()
 }
 
-type job struct {
-	i int
-	f func(i int) float64
-}
-
-type result struct {
-	i int
-	v float64
-}
-
-func worker(jobs <-chan job, results chan<- result) {
-	for j := range jobs {
-		results <- result{i: j.i, v: j.f(j.i)}
-	}
-}
-
 // crossCorrelationMap creates a cross-correlation map based on a filter.
 // ccMapSize is passed so we don't have to recalculate it every time.
 // base is the input where the filter needs to be applied to.
@@ -106,45 +81,6 @@ func (c *ConvolutionLayer) crossCorrelationMap(base, filter *maths.Tensor, ccMap
 	return maths.NewTensor(ccMapSize, ccMapValues)
 }
 
-// crossCorrelationMap creates a cross-correlation map based on a filter.
-// ccMapSize is passed so we don't have to recalculate it every time.
-// base is the input where the filter needs to be applied to.
-func (c *ConvolutionLayer) crossCorrelationMapParallel(base, filter *maths.Tensor, ccMapSize, padding []int) *maths.Tensor {
-	ccMapValues := make([]float64, maths.ProductIntSlice(ccMapSize))
-
-	// We append all regions to slice so we can process each region in parallel. Which might be faster if the regions
-	// are large enough
-	var regions []*maths.ValuesIterator
-	rii := maths.NewRegionsIteratorIterator(base, filter.Dimensions(), padding)
-	for rii.HasNext() {
-		regions = append(regions, rii.Next())
-	}
-
-	// assert regions is not nil
-	if regions == nil {
-		panic("regions is nil, something went wrong")
-	}
-
-	// length of ccMapValues needs to be the same length of regions, else something went wrong
-	if len(ccMapValues) != len(regions) {
-		panic(fmt.Sprintf("len(ccMapValues)=%d != len(regions)=%d", len(ccMapValues), len(regions)))
-	}
-
-	// process each regions Inner Product in parallel using n = runtime.NumCPU() workers
-	for i := range ccMapValues {
-		// Send job to worker
-		c.jobs <- job{i: i, f: func(i int) float64 { return regions[i].InnerProduct(filter) }}
-	}
-	for range ccMapValues {
-		// receive result and set result in ccMapValues
-		res := <-c.results
-		ccMapValues[res.i] = res.v
-	}
-
-	// Return a tensor with the cross-correlation map
-	return maths.NewTensor(ccMapSize, ccMapValues)
-}
-
 func (c *ConvolutionLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
 	c.recentInput = input // might want to rewrite this because it blocks parallel batches
 	var output *maths.Tensor
@@ -169,6 +105,26 @@ func (c *ConvolutionLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
 	return *output
 }
 
+// Infer is ForwardPropagation which keeps nothing for training, every filter is applied by a worker of the pool
+func (c *ConvolutionLayer) Infer(input maths.Tensor) maths.Tensor {
+	var filters []*maths.Tensor
+	for iter := maths.NewRegionsIterator(&c.filters, c.filterDimensionSizes, []int{}); iter.HasNext(); {
+		filters = append(filters, iter.Next())
+	}
+	if filters == nil {
+		panic("ConvolutionLayer.Infer did not work. there are no filters")
+	}
+	maps := make([]*maths.Tensor, len(filters))
+	c.pool.Run(len(filters), func(i int) {
+		maps[i] = c.crossCorrelationMap(&input, filters[i], c.ccMapSize, []int{})
+	})
+	output := maps[0]
+	for _, newMap := range maps[1:] {
+		output = output.AppendTensor(newMap, len(c.filters.Dimensions()))
+	}
+	return *output
+}
+
 func (c *ConvolutionLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
 	var filterGradients *maths.Tensor
 	inputGradients := c.recentInput.Zeroes()
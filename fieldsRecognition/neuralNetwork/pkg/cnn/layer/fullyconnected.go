@@ -78,6 +78,18 @@ func (d *FullyConnectedLayer) ForwardPropagation(input maths.Tensor) maths.Tenso
 	return *maths.NewTensor([]int{len(d.recentOutput)}, d.recentOutput)
 }
 
+func (d *FullyConnectedLayer) Infer(input maths.Tensor) maths.Tensor {
+	output := make([]float64, len(d.biases))
+	i := maths.NewRegionsIterator(&d.weights, d.inputDims, []int{})
+	for i.HasNext() {
+		output[i.CoordIterator.GetCurrentCount()] = i.Next().InnerProduct(&input)
+	}
+	for j := range output {
+		output[j] += d.biases[j]
+	}
+	return *maths.NewTensor([]int{len(output)}, output)
+}
+
 func (d *FullyConnectedLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
 	var weightsGradient *maths.Tensor
 	for i := 0; i < len(gradient.Values()); i++ {
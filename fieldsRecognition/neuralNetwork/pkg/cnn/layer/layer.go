@@ -6,6 +6,8 @@ import (
 
 type Layer interface {
 	ForwardPropagation(input maths.Tensor) maths.Tensor
+	// Infer is ForwardPropagation which keeps nothing for training, so it's safe for concurrent use
+	Infer(input maths.Tensor) maths.Tensor
 	BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor
 	LoadInfo(s string)
 	SaveInfo() string
@@ -63,6 +63,15 @@ func (m *MaxPoolingLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
 
 	return m.outputTensor
 }
+func (m *MaxPoolingLayer) Infer(input maths.Tensor) maths.Tensor {
+	output := m.outputTensor.Zeroes()
+	for iter := maths.NewRegionsIteratorWithStrides(&input, m.sizes, []int{}, m.strides); iter.HasNext(); {
+		nextRegion := iter.Next()
+		output.SetValue(iter.CoordIterator.GetCurrentCount()-1, nextRegion.MaxValue())
+	}
+	return *output
+}
+
 func (m *MaxPoolingLayer) BackwardPropagation(gradient maths.Tensor, lr float64) maths.Tensor {
 	inputGradients := m.inputTensor.Zeroes() // Creates a new tensor with the same dimensions, but zero-valued
 
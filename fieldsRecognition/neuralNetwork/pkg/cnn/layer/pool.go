@@ -0,0 +1,56 @@
+package layer
+
+import (
+	"sync"
+)
+
+// WorkerPool runs the work of the layers of a network, every call waits only for its own jobs,
+// so the pool can be used by many predictions at the same time
+type WorkerPool struct {
+	jobs      chan job
+	closeOnce sync.Once
+}
+
+type job struct {
+	f    func()
+	done *sync.WaitGroup
+}
+
+func NewWorkerPool(workers int) *WorkerPool {
+	pool := &WorkerPool{jobs: make(chan job)}
+	for i := 0; i < workers; i++ {
+		go pool.worker()
+	}
+	return pool
+}
+
+func (pool *WorkerPool) worker() {
+	for j := range pool.jobs {
+		j.f()
+		j.done.Done()
+	}
+}
+
+// Run calls f for every i from 0 to n-1 by the workers and waits for all of them, a nil pool calls them one by one
+func (pool *WorkerPool) Run(n int, f func(i int)) {
+	if pool == nil {
+		for i := 0; i < n; i++ {
+			f(i)
+		}
+		return
+	}
+	var done sync.WaitGroup
+	done.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		pool.jobs <- job{f: func() { f(i) }, done: &done}
+	}
+	done.Wait()
+}
+
+// Close stops the workers, the pool can't be used after that
+func (pool *WorkerPool) Close() {
+	pool.closeOnce.Do(func() {
+		close(pool.jobs)
+	})
+}
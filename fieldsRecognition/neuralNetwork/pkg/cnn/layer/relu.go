@@ -37,6 +37,10 @@ func (o *ReLULayer) derivatives(input maths.Tensor) *maths.Tensor {
 
 func (o *ReLULayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
 	o.recentInput = input
+	return o.Infer(input)
+}
+
+func (o *ReLULayer) Infer(input maths.Tensor) maths.Tensor {
 	output := input.Zeroes()
 	for i := 0; i < input.Len(); i++ {
 		output.SetValue(i, math.Max(input.At(i), 0))
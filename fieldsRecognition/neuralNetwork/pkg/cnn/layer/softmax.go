@@ -23,7 +23,10 @@ func NewSoftmaxLayer(inputDims []int) *SoftmaxLayer {
 
 func (o *SoftmaxLayer) ForwardPropagation(input maths.Tensor) maths.Tensor {
 	o.recentInput = input
+	return o.Infer(input)
+}
 
+func (o *SoftmaxLayer) Infer(input maths.Tensor) maths.Tensor {
 	output := input.Zeroes()
 	expSum := 0.0
 
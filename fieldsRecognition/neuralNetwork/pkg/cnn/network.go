@@ -2,6 +2,7 @@ package cnn
 
 import (
 	"bufio"
+	"errors"
 	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn/layer"
 	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn/maths"
 	"tucklejudge/fieldsRecognition/neuralNetwork/pkg/cnn/metrics"
@@ -12,14 +13,20 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"runtime"
 	"sort"
+	"strings"
 )
 
+// DEBUG saves every image given to the network to lol.png
+const DEBUG = false
+
 type Network struct {
 	layers       []layer.Layer
 	inputDims    []int
 	learningRate float64
 	loss         metrics.LossFunction
+	pool         *layer.WorkerPool // shared by the convolution layers
 }
 
 func New(inputDims []int, learningRate float64, loss metrics.LossFunction) *Network {
@@ -27,7 +34,41 @@ func New(inputDims []int, learningRate float64, loss metrics.LossFunction) *Netw
 		inputDims:    inputDims,
 		learningRate: learningRate,
 		layers:       []layer.Layer{},
-		loss:         loss}
+		loss:         loss,
+		pool:         layer.NewWorkerPool(runtime.NumCPU())}
+}
+
+// Close stops the workers of the network, it can't predict after that
+func (n *Network) Close() {
+	n.pool.Close()
+}
+
+// LoadWeights loads the layers which have weights from <folder>/<index of the layer>.txt
+func (n *Network) LoadWeights(folder string) (err error) {
+	// broken weights make layers panic
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("Weights in %s are broken: %v", folder, r))
+		}
+	}()
+	for i, l := range n.layers {
+		switch l.(type) {
+		case *layer.ConvolutionLayer, *layer.FullyConnectedLayer:
+		default:
+			continue
+		}
+		b, err := os.ReadFile(fmt.Sprintf("%s/%d.txt", folder, i))
+		if err != nil {
+			return err
+		}
+		info := string(b)
+		if _, ok := l.(*layer.ConvolutionLayer); ok {
+			// filters are on the first line
+			info = strings.SplitN(info, "\n", 2)[0]
+		}
+		l.LoadInfo(info)
+	}
+	return nil
 }
 
 func (n *Network) SaveNetworkToFolder() {
@@ -72,7 +113,7 @@ func (n *Network) AddConvolutionLayer(filterDimensions []int, filterCount int) *
 	} else {
 		dims = n.layers[len(n.layers)-1].OutputDims()
 	}
-	n.layers = append(n.layers, layer.NewConvolutionLayer(filterDimensions, filterCount, dims))
+	n.layers = append(n.layers, layer.NewConvolutionLayer(filterDimensions, filterCount, dims, n.pool))
 	return n
 }
 
@@ -200,24 +241,35 @@ func (n *Network) Validate(inputs []maths.Tensor, labels []maths.Tensor) {
 	fmt.Printf("Validation accuracy: %.2f\n", accuracy/float64(len(inputs)))
 }
 
-// Returns a slice of probabilities
+// Returns a slice of probabilities, predictions can be made concurrently
 func (n *Network) Predict(input maths.Tensor) []float64 {
-	output := n.forward(input)
+	output := n.infer(input)
 	return output.Values()
 }
 
-func (n *Network) GetDigitPredictionFromImageArray(dims, img []int) []int {
+// GetDigitProbabilitiesFromImageArray returns probabilities of the digits 0-9, nil means a blank image
+func (n *Network) GetDigitProbabilitiesFromImageArray(dims, img []int) []float64 {
 	if img == nil {
+		return nil
+	}
+	return n.Predict(ArrImageToTensor(dims, img))
+}
+
+func (n *Network) GetDigitPredictionFromImageArray(dims, img []int) []int {
+	return DigitsByProbability(n.GetDigitProbabilitiesFromImageArray(dims, img))
+}
+
+// DigitsByProbability ranks the digits from the most probable one, a blank image is ranked as 10
+func DigitsByProbability(probabilities []float64) []int {
+	if probabilities == nil {
 		return []int{10}
 	}
-	input := ArrImageToTensor(dims, img)
-	predictions := n.Predict(input)
 	digits := make([]int, 10)
 	for i := range digits {
 		digits[i] = i
 	}
 	sort.Slice(digits, func(i, j int) bool {
-		return predictions[digits[i]] > predictions[digits[j]]
+		return probabilities[digits[i]] > probabilities[digits[j]]
 	})
 	return digits
 }
@@ -229,7 +281,9 @@ func ArrImageToTensor(dims, img []int) maths.Tensor {
 			values[i+j*dims[0]] = (128. - float64(img[i*dims[1]+j])) / 255.
 		}
 	}
-	printObjectImage28x28(values)
+	if DEBUG {
+		printObjectImage28x28(values)
+	}
 	return *maths.NewTensor(dims, values)
 }
 
@@ -253,7 +307,7 @@ func printImage(filepath string, img image.Image) {
 
 // Returns the highest index from the prediction
 func (n *Network) PredictIndex(input maths.Tensor) int {
-	output := n.forward(input)
+	output := n.infer(input)
 	return maths.FindMaxIndexFloat64Slice(output.Values())
 }
 
@@ -267,6 +321,16 @@ func (n *Network) forward(input maths.Tensor) maths.Tensor {
 	return output
 }
 
+func (n *Network) infer(input maths.Tensor) maths.Tensor {
+	output := input
+
+	for _, l := range n.layers {
+		output = l.Infer(output)
+	}
+
+	return output
+}
+
 func (n *Network) backward(outputGradient maths.Tensor) maths.Tensor {
 	inputGradient := outputGradient
 
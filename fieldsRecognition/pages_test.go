@@ -0,0 +1,136 @@
+package fieldsRecognition_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"tucklejudge/fieldsRecognition"
+	"tucklejudge/tester/answerSheets"
+	"tucklejudge/utils/formLayout"
+)
+
+// the fixture is a class set of sheets printed for the students, like the scan of a whole class
+const FIXTURE_PAGES = 30
+const FIXTURE_FILE = "sheets.pdf"
+
+// TestMain runs the tests in a copy of the working directory of the server, the layouts and the weights
+// are linked to the ones of the repository and the images of the pages are saved to a temporary src
+func TestMain(m *testing.M) {
+	os.Exit(runInWorkspace(m))
+}
+
+func runInWorkspace(m *testing.M) int {
+	root, err := filepath.Abs("..")
+	if err != nil {
+		panic(err)
+	}
+	workspace, err := os.MkdirTemp("", "fieldsRecognition")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(workspace)
+	for _, folder := range []string{"assets", "fieldsRecognition"} {
+		err = os.Symlink(filepath.Join(root, folder), filepath.Join(workspace, folder))
+		if err != nil {
+			panic(err)
+		}
+	}
+	err = os.Mkdir(filepath.Join(workspace, "src"), 0755)
+	if err != nil {
+		panic(err)
+	}
+	err = os.WriteFile(filepath.Join(workspace, "src", "currentID.txt"), []byte("0"), 0600)
+	if err != nil {
+		panic(err)
+	}
+	err = os.Chdir(workspace)
+	if err != nil {
+		panic(err)
+	}
+	err = fieldsRecognition.LoadNetwork()
+	if err != nil {
+		panic(err)
+	}
+	err = writeFixture(FIXTURE_FILE, FIXTURE_PAGES)
+	if err != nil {
+		panic(err)
+	}
+	return m.Run()
+}
+
+// writeFixture prints the sheets of a test for the students with the IDs from 0001
+func writeFixture(fileName string, pages int) error {
+	layout, err := formLayout.GetLayout(formLayout.DEFAULT_LAYOUT)
+	if err != nil {
+		return err
+	}
+	sheets := make([]answerSheets.Sheet, pages)
+	for i := range sheets {
+		sheets[i] = answerSheets.Sheet{
+			TestID: "0042",
+			TestName: "Benchmark",
+			UserID: fmt.Sprintf("%04d", i+1),
+			FullName: fmt.Sprintf("Student %d", i+1),
+		}
+	}
+	doc, err := answerSheets.GenerateSheets(layout, sheets)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = doc.WriteTo(f)
+	return err
+}
+
+// readFixture reads all pages of the fixture at the same time like a check job does
+func readFixture(b *testing.B) {
+	pages, err := fieldsRecognition.OpenPages(FIXTURE_FILE)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pages.Close()
+	n := pages.Count()
+	results := make([]fieldsRecognition.PageResult, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = fieldsRecognition.BringTestResultsFromPage(pages, i, "", false)
+		}(i)
+	}
+	wg.Wait()
+	// students of the fixture aren't registered, but every page must be read
+	for i := range results {
+		if errs[i] != nil {
+			b.Fatal(errs[i])
+		}
+		if results[i].Values == nil {
+			b.Fatalf("page %d wasn't read: %v", i+1, results[i].Err)
+		}
+	}
+}
+
+// BenchmarkPages reads the 30-page fixture one page at a time and with a page worker for every CPU
+func BenchmarkPages(b *testing.B) {
+	counts := []int{1}
+	if runtime.NumCPU() > 1 {
+		counts = append(counts, runtime.NumCPU())
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("page-workers=%d", workers), func(b *testing.B) {
+			fieldsRecognition.SetPageWorkers(workers)
+			for i := 0; i < b.N; i++ {
+				readFixture(b)
+			}
+		})
+	}
+}
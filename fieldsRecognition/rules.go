@@ -0,0 +1,196 @@
+package fieldsRecognition
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"tucklejudge/utils/formLayout"
+)
+
+// printed rules are runs of ink this long, vertical ones in parts of the field height and horizontal ones
+// in parts of its width, the gaps of dashed lines up to RULE_GAP of the field height are bridged
+const VERTICAL_RULE_LENGTH = 0.6
+const HORIZONTAL_RULE_LENGTH = 0.3
+const RULE_GAP = 0.2
+// the top and bottom of the field are looked for in this part of its height at its edges,
+// the sides of a free-form field are looked for as far from its ends
+const RULE_BAND = 0.3
+// a stroke touches a rule when there's ink of it this near to the rule
+const TOUCH_REACH = 2
+// a stroke along a rule makes it this many pixels thicker at least
+const RULE_THICKENING = 2
+
+// ruleMask marks the ink of the long runs along the lines, at(i, t) is the point t of the line i,
+// a run is followed on the neighbour lines too, so a slightly slanted rule isn't broken
+func ruleMask(img *image.Gray, lines []int, length int, minRun, gap float64, at func(line, t int) image.Point) map[image.Point]bool {
+	mask := make(map[image.Point]bool)
+	for _, line := range lines {
+		inkAt := func(t int) bool {
+			for d := -1; d <= 1; d++ {
+				p := at(line+d, t)
+				if isInk(img, p.X, p.Y) {
+					return true
+				}
+			}
+			return false
+		}
+		start, last := -1, -1
+		mark := func() {
+			if start >= 0 && float64(last-start+1) >= minRun {
+				for t := start; t <= last; t++ {
+					if p := at(line, t); isInk(img, p.X, p.Y) {
+						mask[p] = true
+					}
+				}
+			}
+		}
+		for t := 0; t < length; t++ {
+			if !inkAt(t) {
+				continue
+			}
+			if start < 0 || float64(t-last-1) > gap {
+				mark()
+				start = t
+			}
+			last = t
+		}
+		mark()
+	}
+	return mask
+}
+
+// bandWidth is how thick the rule is at the point across it, step is the direction across the rule
+func bandWidth(p, step image.Point, rules map[image.Point]bool) int {
+	width := 1
+	for q := p.Add(step); rules[q]; q = q.Add(step) {
+		width++
+	}
+	for q := p.Sub(step); rules[q]; q = q.Sub(step) {
+		width++
+	}
+	return width
+}
+
+// usualWidth is the median thickness of the rules of the mask
+func usualWidth(mask map[image.Point]bool, step image.Point) int {
+	widths := make([]int, 0, len(mask))
+	for p := range mask {
+		widths = append(widths, bandWidth(p, step, mask))
+	}
+	if len(widths) == 0 {
+		return 0
+	}
+	sort.Ints(widths)
+	return widths[len(widths)/2]
+}
+
+// touches tells whether a stroke goes over the rule or ends at it at the point, step is the direction across the rule,
+// the ink of the stroke mustn't be a part of the rules itself
+func touches(img *image.Gray, p, step image.Point, rules map[image.Point]bool) bool {
+	// slanted strokes cross the rule at the next point along it
+	along := image.Point{step.Y, step.X}
+	side := func(step image.Point) bool {
+		q := p
+		for rules[q] {
+			q = q.Add(step)
+		}
+		for i := 0; i < TOUCH_REACH; i++ {
+			for _, r := range []image.Point{q, q.Add(along), q.Sub(along)} {
+				if isInk(img, r.X, r.Y) && !rules[r] {
+					return true
+				}
+			}
+			q = q.Add(step)
+		}
+		return false
+	}
+	return side(step) || side(image.Point{-step.X, -step.Y})
+}
+
+// gridOffset is how far the lines of the grid of the cells are shifted, it's where most of the long vertical runs are,
+// the field of a distorted page may be cut out a bit aside
+func gridOffset(runs map[image.Point]bool, width int, cellWidth float64) float64 {
+	columns := make([]int, width)
+	for p := range runs {
+		columns[p.X]++
+	}
+	best, bestScore := 0, 0
+	for offset := -int(cellWidth / 2); offset <= int(cellWidth/2); offset++ {
+		score := 0
+		for x, count := range columns {
+			shifted := float64(x - offset)
+			if math.Abs(shifted-math.Round(shifted/cellWidth)*cellWidth) <= 2 {
+				score += count
+			}
+		}
+		if score > bestScore || score == bestScore && IntAbs(offset) < IntAbs(best) {
+			best, bestScore = offset, score
+		}
+	}
+	return float64(best)
+}
+
+// removeRules erases the printed rules of the inverted field: the dividers of the cells and its dashed border.
+// They're long straight runs of ink where the layout prints them, strokes written across or along them are kept,
+// so a digit written over a divider isn't broken
+func removeRules(img *image.Gray, field *formLayout.Field) *image.Gray {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	gap := RULE_GAP * float64(height)
+	band := int(RULE_BAND * float64(height))
+
+	columns := make([]int, width)
+	for x := range columns {
+		columns[x] = x
+	}
+	rows := make([]int, 0)
+	for y := 0; y < height; y++ {
+		if y <= band || y >= height-1-band {
+			rows = append(rows, y)
+		}
+	}
+	runs := ruleMask(img, columns, height, VERTICAL_RULE_LENGTH*float64(height), gap, func(x, y int) image.Point { return image.Pt(x, y) })
+	// a tall digit is a long run too, so only the runs on the lines of the grid are rules, the sides of a free-form field
+	cellWidth := float64(width) / float64(field.Cells)
+	offset := gridOffset(runs, width, cellWidth)
+	vertical := make(map[image.Point]bool)
+	for p := range runs {
+		x := float64(p.X) - offset
+		if field.FreeForm && (p.X <= band || p.X >= width-1-band) ||
+			!field.FreeForm && math.Abs(x-math.Round(x/cellWidth)*cellWidth) <= RULE_DRIFT*cellWidth {
+			vertical[p] = true
+		}
+	}
+	horizontal := ruleMask(img, rows, width, HORIZONTAL_RULE_LENGTH*float64(width), gap, func(y, x int) image.Point { return image.Pt(x, y) })
+	rules := make(map[image.Point]bool)
+	for p := range vertical {
+		rules[p] = true
+	}
+	for p := range horizontal {
+		rules[p] = true
+	}
+
+	result := copyGray(img)
+	erase := func(p image.Point) {
+		result.SetGray(p.X, p.Y, color.Gray{})
+		// the pale edges of the rule go too, the ink next to it stays
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				if q := p.Add(image.Pt(dx, dy)); !isInk(img, q.X, q.Y) {
+					result.SetGray(q.X, q.Y, color.Gray{})
+				}
+			}
+		}
+	}
+	// a stroke written along a rule makes it thicker, so the rule is kept where it's thicker than usual
+	verticalWidth, horizontalWidth := usualWidth(vertical, image.Pt(1, 0)), usualWidth(horizontal, image.Pt(0, 1))
+	kept := func(p, step image.Point, mask map[image.Point]bool, usual int) bool {
+		return touches(img, p, step, rules) || bandWidth(p, step, mask) >= usual+RULE_THICKENING
+	}
+	for p := range rules {
+		if vertical[p] && !kept(p, image.Pt(1, 0), vertical, verticalWidth) || horizontal[p] && !kept(p, image.Pt(0, 1), horizontal, horizontalWidth) {
+			erase(p)
+		}
+	}
+	return result
+}
@@ -0,0 +1,277 @@
+package fieldsRecognition
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"tucklejudge/utils/formLayout"
+)
+
+// pieces of ink smaller than this part of the squared height of the field are specks, not strokes
+const MIN_DIGIT_INK = 0.02
+// pieces of a digit overlap horizontally by this part of the narrower one, like the bar and the body of a 5
+const MERGE_OVERLAP = 0.5
+// a short piece no farther from a digit than this part of the digit width is a part of it
+const MERGE_GAP = 0.25
+// a piece wider than this many digit widths is a few digits written together
+const SPLIT_WIDTH = 1.4
+// digits are cut where the ink is thinnest this far from where they're expected to meet, in digit widths
+const SPLIT_SEARCH = 0.3
+// digits of a free-form field are about this part of their height wide
+const FREE_DIGIT_WIDTH = 0.6
+// printed rules are thinner than this part of the field height and stand this near
+// to their places on the layout, in cell widths
+const RULE_THICKNESS = 0.2
+const RULE_TOLERANCE = 0.12
+const RULE_DRIFT = 0.3 // for the ones down to the bottom of the field
+// pixels of the inverted field brighter than this are pale edges of the strokes, they belong to a digit
+// they're connected to at most this many pixels away unless they're printed rules
+const PALE_LEVEL = 32
+const PALE_REACH = 3
+
+// segment is one digit written in a field
+type segment struct {
+	bounds image.Rectangle // of the ink
+	window image.Rectangle // the digit is read in, it holds all of the digit
+	cell int // of the grid, digits of a free-form field are numbered in the order of writing
+	img *image.Gray // the field with only the ink of the digit
+}
+
+func pixelBounds(pixels []IntPair) image.Rectangle {
+	result := image.Rect(pixels[0].first, pixels[0].second, pixels[0].first+1, pixels[0].second+1)
+	for _, p := range pixels {
+		result = result.Union(image.Rect(p.first, p.second, p.first+1, p.second+1))
+	}
+	return result
+}
+
+func centerX(rect image.Rectangle) float64 {
+	return float64(rect.Min.X+rect.Max.X) / 2
+}
+
+// inkComponents are the connected pieces of ink of the rectangle of the inverted field
+func inkComponents(img *image.Gray, rect image.Rectangle) [][]IntPair {
+	mask := image.NewGray(rect)
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			if isInk(img, x, y) {
+				mask.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return getWhiteComponents(mask)
+}
+
+// digitHeight is the height of the tallest pieces of ink, they're whole digits unlike bars and dots,
+// the interior height is given when the field is empty
+func digitHeight(parts [][]IntPair, interiorHeight float64) float64 {
+	heights := make([]int, 0, len(parts))
+	for _, part := range parts {
+		heights = append(heights, pixelBounds(part).Dy())
+	}
+	if len(heights) == 0 {
+		return interiorHeight
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(heights)))
+	// the tallest one may be a few digits one above another, so the median of the taller half is taken
+	return float64(heights[(len(heights)-1)/4])
+}
+
+// isRule tells whether the piece is a printed divider, a side of the field or the top or bottom of it,
+// the rules are erased before, but pieces of them may be left on a distorted page
+func isRule(rect, interior image.Rectangle, cellWidth float64) bool {
+	thickness := RULE_THICKNESS * float64(interior.Dy())
+	if float64(rect.Dx()) <= thickness {
+		center := centerX(rect)
+		drift := math.Abs(center-math.Round(center/cellWidth)*cellWidth) / cellWidth
+		// dividers go down to the bottom of the field, so they're found there even on a distorted page
+		if drift <= RULE_TOLERANCE || drift <= RULE_DRIFT && rect.Max.Y >= interior.Max.Y {
+			return true
+		}
+	}
+	return float64(rect.Dy()) <= thickness && (rect.Min.Y <= interior.Min.Y || rect.Max.Y >= interior.Max.Y)
+}
+
+// mergeParts joins the pieces of every digit: the ones above each other and the short ones next to a digit,
+// pieces in different cells of the grid aren't joined unless one of them is short
+func mergeParts(parts [][]IntPair, digitWidth, height, cellWidth float64, grid bool) [][]IntPair {
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(parts) && !merged; i++ {
+			for j := i + 1; j < len(parts) && !merged; j++ {
+				a, b := pixelBounds(parts[i]), pixelBounds(parts[j])
+				overlap := float64(min(a.Max.X, b.Max.X) - max(a.Min.X, b.Min.X))
+				short := float64(min(a.Dy(), b.Dy())) < height/3
+				if grid && !short && int(centerX(a)/cellWidth) != int(centerX(b)/cellWidth) {
+					continue
+				}
+				if overlap >= MERGE_OVERLAP*float64(min(a.Dx(), b.Dx())) || short && -overlap <= MERGE_GAP*digitWidth {
+					parts[i] = append(parts[i], parts[j]...)
+					parts = append(parts[:j], parts[j+1:]...)
+					merged = true
+				}
+			}
+		}
+	}
+	return parts
+}
+
+// splitPart cuts a piece of a few digits written together where the ink is thinnest, near the dividers
+// of the grid or, in a free-form field, near where digits of the usual width would meet
+func splitPart(part []IntPair, digitWidth, cellWidth float64, cells int, grid bool) [][]IntPair {
+	rect := pixelBounds(part)
+	columns := make([]int, rect.Dx())
+	for _, p := range part {
+		columns[p.first-rect.Min.X]++
+	}
+	expected := make([]float64, 0)
+	if grid {
+		for k := 1; k < cells; k++ {
+			x := float64(k) * cellWidth
+			if x > float64(rect.Min.X)+SPLIT_SEARCH*digitWidth && x < float64(rect.Max.X)-SPLIT_SEARCH*digitWidth {
+				expected = append(expected, x)
+			}
+		}
+	} else {
+		n := max(2, int(math.Round(float64(rect.Dx())/digitWidth)))
+		for i := 1; i < n; i++ {
+			expected = append(expected, float64(rect.Min.X)+float64(i*rect.Dx())/float64(n))
+		}
+	}
+	if len(expected) == 0 {
+		// a wide digit that doesn't cross a divider
+		return [][]IntPair{part}
+	}
+	cuts := make([]int, len(expected))
+	for i, x := range expected {
+		best := -1
+		for c := max(rect.Min.X+1, int(x-SPLIT_SEARCH*digitWidth)); c <= min(rect.Max.X-1, int(x+SPLIT_SEARCH*digitWidth)); c++ {
+			if best == -1 || columns[c-rect.Min.X] < columns[best-rect.Min.X] ||
+				columns[c-rect.Min.X] == columns[best-rect.Min.X] && math.Abs(float64(c)-x) < math.Abs(float64(best)-x) {
+				best = c
+			}
+		}
+		cuts[i] = best
+	}
+	result := make([][]IntPair, len(cuts)+1)
+	for _, p := range part {
+		piece := sort.SearchInts(cuts, p.first+1)
+		result[piece] = append(result[piece], p)
+	}
+	return result
+}
+
+// segmentField finds the digits written in the field by the pieces of ink in it, they're in the order of writing.
+// The grid of the cells tells which pieces are printed rules, which are parts of one digit and where digits
+// written together are cut, a digit belongs to the cell its middle is in
+func segmentField(img *image.Gray, field *formLayout.Field) []segment {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	borders := int(float64(height) * field.Margin)
+	interior := image.Rect(borders, borders, width-borders, height-borders)
+	innerHeight := float64(interior.Dy())
+	cellWidth := float64(width) / float64(field.Cells)
+	grid := !field.FreeForm
+	digitWidth := cellWidth
+
+	parts := make([][]IntPair, 0)
+	rules := make(map[IntPair]bool)
+	for _, part := range inkComponents(img, interior) {
+		if grid && isRule(pixelBounds(part), interior, cellWidth) {
+			for _, p := range part {
+				rules[p] = true
+			}
+			continue
+		}
+		if float64(len(part)) >= MIN_DIGIT_INK*innerHeight*innerHeight {
+			parts = append(parts, part)
+		}
+	}
+	// digits written smaller than their cells are told apart by their height
+	splitWidth := FREE_DIGIT_WIDTH * digitHeight(parts, innerHeight)
+	if grid {
+		splitWidth = math.Min(splitWidth, cellWidth)
+	} else {
+		digitWidth = splitWidth
+	}
+	parts = mergeParts(parts, digitWidth, innerHeight, cellWidth, grid)
+	digits := make([][]IntPair, 0, len(parts))
+	for _, part := range parts {
+		if float64(pixelBounds(part).Dx()) <= SPLIT_WIDTH*splitWidth {
+			digits = append(digits, part)
+			continue
+		}
+		for _, piece := range splitPart(part, splitWidth, cellWidth, field.Cells, grid) {
+			if float64(len(piece)) >= MIN_DIGIT_INK*innerHeight*innerHeight {
+				digits = append(digits, piece)
+			}
+		}
+	}
+	sort.Slice(digits, func(i, j int) bool {
+		return centerX(pixelBounds(digits[i])) < centerX(pixelBounds(digits[j]))
+	})
+
+	// the pale edges of the strokes and the specks next to them are given to the nearest digit they touch,
+	// so the digit isn't made thinner, every pixel belongs to one digit at most
+	owner := make(map[IntPair]int)
+	queue := make([]IntPair, 0)
+	for i, digit := range digits {
+		for _, p := range digit {
+			owner[p] = i
+			queue = append(queue, p)
+		}
+	}
+	reach := make(map[IntPair]int)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if reach[p] == PALE_REACH {
+			continue
+		}
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				q := IntPair{p.first + dx, p.second + dy}
+				if _, ok := owner[q]; ok || rules[q] || !image.Pt(q.first, q.second).In(interior) || img.GrayAt(q.first, q.second).Y <= PALE_LEVEL {
+					continue
+				}
+				owner[q] = owner[p]
+				reach[q] = reach[p] + 1
+				queue = append(queue, q)
+			}
+		}
+	}
+	segments := make([]segment, len(digits))
+	for i, digit := range digits {
+		rect := pixelBounds(digit)
+		s := &segments[i]
+		s.bounds = rect
+		s.cell = i
+		if grid {
+			s.cell = min(max(int(centerX(rect)/cellWidth), 0), field.Cells-1)
+		}
+		// a digit in a cell is read in the same window as the middle of the cell, the window is moved with the digit
+		half := int(digitWidth / 2)
+		if grid {
+			half = int((cellWidth - 1.5*float64(borders)) / 2)
+		}
+		s.window = image.Rect(int(centerX(rect))-half, interior.Min.Y, int(centerX(rect))+half, interior.Max.Y).Union(rect).Intersect(img.Bounds())
+		s.img = image.NewGray(img.Bounds())
+	}
+	for p, i := range owner {
+		segments[i].img.SetGray(p.first, p.second, img.GrayAt(p.first, p.second))
+	}
+	return segments
+}
+
+// leftoverInk is the field without the ink of the digits, the blank cells are checked on it
+func leftoverInk(img *image.Gray, segments []segment) *image.Gray {
+	result := copyGray(img)
+	for _, s := range segments {
+		for i, value := range s.img.Pix {
+			if value > 0 {
+				result.Pix[i] = 0
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+package fieldsRecognition
+
+import (
+	"image"
+	"strconv"
+	"tucklejudge/utils/formLayout"
+	"tucklejudge/utils/sheetCode"
+)
+
+// minimal difference of gray between black and white timing cells
+const SHEET_CODE_CONTRAST = 60
+
+// cellGray is the mean gray of the middle of the cell, shift is given in cells
+func cellGray(img *image.Gray, layout *formLayout.Layout, corners [3]Point, row, column int, shiftX, shiftY float64) float64 {
+	cellW := layout.Code.W / sheetCode.BITS
+	cellH := layout.Code.H / 2
+	cx := layout.Code.X + cellW*(float64(column)+0.5+shiftX)
+	cy := layout.Code.Y + cellH*(float64(row)+0.5+shiftY)
+	minX, minY := pageToDocument(layout, cx-cellW/4, cy-cellH/4, corners)
+	maxX, maxY := pageToDocument(layout, cx+cellW/4, cy+cellH/4, corners)
+	sum := 0.
+	count := 0
+	for i := minX; i <= maxX; i++ {
+		for j := minY; j <= maxY; j++ {
+			if (image.Point{i, j}).In(img.Bounds()) {
+				sum += float64(img.GrayAt(i, j).Y)
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return 255
+	}
+	return sum / float64(count)
+}
+
+// readCells reads the data row when every cell of the timing row is where it should be
+func readCells(img *image.Gray, layout *formLayout.Layout, corners [3]Point, shiftX, shiftY float64) ([]bool, bool) {
+	black, white := 0., 0.
+	for i := 0; i < sheetCode.BITS; i++ {
+		if sheetCode.TimingCell(i) {
+			black += cellGray(img, layout, corners, 0, i, shiftX, shiftY)
+		} else {
+			white += cellGray(img, layout, corners, 0, i, shiftX, shiftY)
+		}
+	}
+	black /= float64((sheetCode.BITS + 1) / 2)
+	white /= float64(sheetCode.BITS / 2)
+	if white-black < SHEET_CODE_CONTRAST {
+		return nil, false
+	}
+	threshold := (black + white) / 2
+	for i := 0; i < sheetCode.BITS; i++ {
+		if (cellGray(img, layout, corners, 0, i, shiftX, shiftY) < threshold) != sheetCode.TimingCell(i) {
+			return nil, false
+		}
+	}
+	bits := make([]bool, sheetCode.BITS)
+	for i := range bits {
+		bits[i] = cellGray(img, layout, corners, 1, i, shiftX, shiftY) < threshold
+	}
+	return bits, true
+}
+
+// readSheetCode decodes the code of generated sheets, small shifts of the print are tried as well
+func readSheetCode(init image.Image, layout *formLayout.Layout, corners [3]Point) (*sheetCode.Code, error) {
+	img := imageToGrayScale(init)
+	err := sheetCode.ErrNoCode
+	shifts := []float64{0, -0.25, 0.25, -0.5, 0.5}
+	for _, shiftY := range shifts {
+		for _, shiftX := range shifts {
+			bits, ok := readCells(img, layout, corners, shiftX, shiftY)
+			if !ok {
+				continue
+			}
+			var code *sheetCode.Code
+			code, err = sheetCode.Decode(bits)
+			if err == nil {
+				return code, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// applySheetCode puts decoded values instead of the handwritten ones
+func applySheetCode(values *formLayout.Values, code *sheetCode.Code) {
+	values.SetDecoded(formLayout.ROLE_TEST_ID, code.TestID)
+	if code.UserID != "" {
+		values.SetDecoded(formLayout.ROLE_USER_ID, code.UserID)
+	}
+	if code.Variant != 0 {
+		values.SetDecoded(formLayout.ROLE_VARIANT, strconv.Itoa(code.Variant))
+	}
+}
@@ -0,0 +1,92 @@
+package fieldsRecognition
+
+import (
+	"image"
+	"tucklejudge/utils/formLayout"
+)
+
+// a strike-through is a straight line over most of the cell width, digits are narrower than their cells,
+// so even their horizontal strokes cover much less of it
+const STRIKE_SPAN = 0.8 // part of the cell width a line is followed along
+const STRIKE_COVERAGE = 0.9 // part of the line that is ink when the cell is crossed out
+const STRIKE_DOUBT = 0.75 // lines covered less but more than this make the cell doubtful
+const STRIKE_MAX_SLOPE = 0.6 // steeper lines aren't strike-throughs
+// a scribbled over cell is mostly ink, a digit covers much less of it
+const SCRIBBLE_INK = 0.4
+const SCRIBBLE_DOUBT = 0.3
+// the cancel box is ticked when this part of its middle is ink, boxes with less ink but more than BLANK_INK are doubtful,
+// the border of the box is left out of the middle
+const CANCEL_INK = 0.1
+const CANCEL_BORDER = 0.3
+
+func isInk(img *image.Gray, x, y int) bool {
+	return image.Pt(x, y).In(img.Bounds()) && img.GrayAt(x, y).Y > INK_LEVEL
+}
+
+// middleInk is the part of the rectangle covered with ink, the given part of its width and height is left out at every side
+func middleInk(rect image.Rectangle, img *image.Gray, border float64) float64 {
+	dx, dy := int(float64(rect.Dx())*border), int(float64(rect.Dy())*border)
+	middle := image.Rect(rect.Min.X+dx, rect.Min.Y+dy, rect.Max.X-dx, rect.Max.Y-dy).Intersect(img.Bounds())
+	if middle.Empty() {
+		return 0
+	}
+	ink := 0
+	for x := middle.Min.X; x < middle.Max.X; x++ {
+		for y := middle.Min.Y; y < middle.Max.Y; y++ {
+			if isInk(img, x, y) {
+				ink++
+			}
+		}
+	}
+	return float64(ink) / float64(middle.Dx()*middle.Dy())
+}
+
+// strikeCoverage is the largest part of a straight line across the cell which is ink, lines go through
+// the middle of the cell width at every height but the top and bottom sixths
+func strikeCoverage(rect image.Rectangle, img *image.Gray) float64 {
+	samples := int(float64(rect.Dx()) * STRIKE_SPAN)
+	if samples == 0 {
+		return 0
+	}
+	start := float64(rect.Min.X) + float64(rect.Dx())*(1-STRIKE_SPAN)/2
+	middle := float64(rect.Min.X+rect.Max.X) / 2
+	best := 0.
+	for y := rect.Min.Y + rect.Dy()/6; y < rect.Max.Y-rect.Dy()/6; y++ {
+		for slope := -STRIKE_MAX_SLOPE; slope <= STRIKE_MAX_SLOPE+1e-9; slope += 0.05 {
+			covered := 0
+			for i := 0; i < samples; i++ {
+				x := start + float64(i)
+				lineY := int(float64(y) + slope*(x-middle) + 0.5)
+				// strokes are a few pixels thick, so the pixels next to the line count too
+				if isInk(img, int(x), lineY) || isInk(img, int(x), lineY-1) || isInk(img, int(x), lineY+1) {
+					covered++
+				}
+			}
+			best = max(best, float64(covered)/float64(samples))
+		}
+	}
+	return best
+}
+
+// crossedOut tells whether the cell with ink is crossed out or scribbled over, so it's void,
+// a doubtful cell is read but waits for review
+func crossedOut(rect image.Rectangle, img *image.Gray) (void, doubtful bool) {
+	density := middleInk(rect, img, 0)
+	strike := strikeCoverage(rect, img)
+	void = density >= SCRIBBLE_INK || strike >= STRIKE_COVERAGE
+	doubtful = !void && (density >= SCRIBBLE_DOUBT || strike >= STRIKE_DOUBT)
+	return void, doubtful
+}
+
+// cancelTicked tells whether the cancel box of the field is ticked and how sure it is, img is the inverted document
+func cancelTicked(img *image.Gray, layout *formLayout.Layout, field *formLayout.Field, corners [3]Point) (ticked bool, confidence float64, ink float64) {
+	box := rectImage(img, layout, *field.Cancel, corners)
+	ink = middleInk(box.Bounds(), box, CANCEL_BORDER)
+	switch {
+	case ink >= CANCEL_INK:
+		return true, 1, ink
+	case ink >= BLANK_INK:
+		return false, 0, ink
+	}
+	return false, blankConfidence(ink), ink
+}
@@ -6,4 +6,5 @@ require (
 	github.com/Arafatk/glot v0.0.0-20180312013246-79d5219000f0
 	github.com/gen2brain/go-fitz v1.19.0
 	golang.org/x/exp v0.0.0-20220609121020-a51bd0440498
+	golang.org/x/image v0.18.0
 )
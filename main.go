@@ -1,19 +1,41 @@
 package main
 
 import (
+	"flag"
 	"net/http"
 	"log"
+	"runtime"
 	"time"
+	"tucklejudge/fieldsRecognition"
 	"tucklejudge/authentication"
 	"tucklejudge/mainMenu"
 	"tucklejudge/tester/testCreator"
 	"tucklejudge/tester/testViewer"
 	"tucklejudge/tester/testChecker"
+	"tucklejudge/tester/gradingScales"
+	"tucklejudge/tester/questionBank"
+	"tucklejudge/tester/answerSheets"
 	"tucklejudge/utils"
 )
 
 func main() {
+	pageWorkers := flag.Int("page-workers", runtime.NumCPU(), "number of pages recognized at the same time")
+	pdfDPI := flag.Float64("pdf-dpi", 300, "DPI pages of uploaded PDFs are rendered at")
+	maxPages := flag.Int("max-pages", 200, "most pages of an uploaded file")
+	maxPagePixels := flag.Int("max-page-pixels", 50000000, "most pixels of an uploaded page")
+	flag.Parse()
+	fieldsRecognition.SetPageWorkers(*pageWorkers)
+	fieldsRecognition.SetUploadLimits(*pdfDPI, *maxPages, *maxPagePixels)
+
 	utils.Init()
+	err := fieldsRecognition.LoadNetwork()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = testChecker.StartCheckWorkers()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	cookieTicker := time.NewTicker(168*time.Hour)
 	newVerificationCodeTicker := time.NewTicker(48*time.Hour)
@@ -44,14 +66,35 @@ func main() {
 	http.HandleFunc("/test/createTest", testCreator.TestCreatorHandler)
 	http.HandleFunc("/test/editTest/", testCreator.TestEditHandler)
 	http.HandleFunc("/test/createTest/process", testCreator.CreationProcessHandler)
+	http.HandleFunc("/test/importTest/process", testCreator.TestImportHandler)
+	http.HandleFunc("/test/exportTest/", testCreator.TestExportHandler)
 	http.HandleFunc("/test/saveTest/process/", testCreator.SavingProcessHandler)
 	http.HandleFunc("/test/deleteTest/process/", testCreator.TestDeletionHandler)
+	http.HandleFunc("/test/archiveTest/process/", testCreator.TestArchivingHandler)
+	http.HandleFunc("/test/shareTest/process/", testCreator.TestSharingHandler)
+
+	http.HandleFunc("/test/answerSheets/", answerSheets.AnswerSheetsHandler)
 
 	http.HandleFunc("/test/view/", testViewer.TestViewHandler)
 	http.HandleFunc("/test/teacherView/", testViewer.TeacherTestViewHandler)
 
 	http.HandleFunc("/test/checkTest", testChecker.TestCheckHandler)
 	http.HandleFunc("/test/recheckTest/", testChecker.TestRecheckHandler)
+	http.HandleFunc("/test/checkJob/", testChecker.CheckJobHandler)
+	http.HandleFunc("/test/reviewQueue", testChecker.ReviewQueueHandler)
+	http.HandleFunc("/test/approveResult/process/", testChecker.ResultApprovalHandler)
+	http.HandleFunc("/test/reviewResult/", testChecker.ResultReviewHandler)
+	http.HandleFunc("/test/reviewResult/process/", testChecker.ResultCorrectionHandler)
+	http.HandleFunc("/test/debugBundle/", testChecker.DebugBundleHandler)
+
+	http.HandleFunc("/bank/", questionBank.QuestionBankHandler)
+	http.HandleFunc("/bank/saveQuestion/process", questionBank.QuestionSavingHandler)
+	http.HandleFunc("/bank/deleteQuestion/process/", questionBank.QuestionDeletionHandler)
+	http.HandleFunc("/bank/assembleTest/process", questionBank.TestAssemblyHandler)
+
+	http.HandleFunc("/admin/gradingScales", gradingScales.GradingScalesHandler)
+	http.HandleFunc("/admin/gradingScales/process", gradingScales.GradingScalesSavingHandler)
+	http.HandleFunc("/admin/reloadNetwork", fieldsRecognition.ReloadNetworkHandler)
 
 	// http.HandleFunc("lesson/changeMarks/", lessonEditor.ChangeMarksHandler)
 	// http.HandleFunc("/test/deployToElectronicMarkBook/", lessonEditor.DeployToElectronicMarkBookHandler)
@@ -3,6 +3,7 @@ package mainMenu
 import (
 	"net/http"
 	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
 	"fmt"
 )
 
@@ -12,12 +13,15 @@ type MenuUI struct {
 	Teacher bool
 	Tests []TestUI
 	Classes []TestUI
+	Layouts []*formLayout.Layout
 	OnlyForAdminVecificationCode string
 }
 
 type TestUI struct {
 	TestID string
 	TestName string
+	Right string
+	Archived bool
 }
 
 func MainPageHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +49,8 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 				}
 				tests[len(tests)-1].TestName = t.Name
+				tests[len(tests)-1].Right = utils.GetTestRight(&t, username)
+				tests[len(tests)-1].Archived = t.Archived
 			} else {
 				classes = append(classes, TestUI{})
 				classes[len(classes)-1].TestID = id
@@ -78,6 +84,13 @@ func MainPageHandler(w http.ResponseWriter, r *http.Request) {
 		Classes: classes,
 		OnlyForAdminVecificationCode: "",
 	}
+	if user.Teacher {
+		menu.Layouts, err = formLayout.GetLayouts()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	if utils.CheckForAdmin(r) == true {
 		menu.OnlyForAdminVecificationCode = utils.VerificationCode
 	}
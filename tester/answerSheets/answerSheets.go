@@ -0,0 +1,291 @@
+package answerSheets
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
+	"tucklejudge/utils/pdfWriter"
+	"tucklejudge/utils/sheetCode"
+)
+
+// sizes of the lines in points
+const LINE_WIDTH = 0.6 * pdfWriter.MM
+const DASH = 2 * pdfWriter.MM
+const LABEL_GRAY = 0.4
+// labels are half as high as their fields and stand a bit to the left of them
+const LABEL_SIZE = 0.5
+const LABEL_GAP = 5 * pdfWriter.MM
+// labels of fields with cancel boxes stand nearer, so they fit between the columns
+const CANCEL_LABEL_GAP = 1.5 * pdfWriter.MM
+const CANCEL_HINT = "Tick the box before an answer to cancel it"
+
+// cyrillic letters are transliterated as standard PDF fonts have only Latin-1
+var transliteration = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+func Transliterate(text string) string {
+	var out strings.Builder
+	for _, c := range text {
+		lower := []rune(strings.ToLower(string(c)))[0]
+		latin, ok := transliteration[lower]
+		if !ok {
+			out.WriteRune(c)
+			continue
+		}
+		if lower != c && len(latin) > 0 {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		out.WriteString(latin)
+	}
+	return out.String()
+}
+
+// handwriting-like strokes of the digits in a unit box, the network recognizes them better than printed fonts
+var digitStrokes = [10][][]float64{
+	{{0.5, 0, 0.2, 0.12, 0.05, 0.5, 0.2, 0.88, 0.5, 1, 0.8, 0.88, 0.95, 0.5, 0.8, 0.12, 0.5, 0}},
+	{{0.4, 0.12, 0.6, 0, 0.6, 1}},
+	{{0.12, 0.25, 0.3, 0.04, 0.6, 0.02, 0.82, 0.2, 0.8, 0.42, 0.12, 1, 0.9, 1}},
+	{{0.1, 0.12, 0.45, 0, 0.8, 0.12, 0.78, 0.35, 0.5, 0.48}, {0.5, 0.48, 0.85, 0.62, 0.85, 0.88, 0.5, 1, 0.1, 0.88}},
+	{{0.25, 0, 0.1, 0.62, 0.92, 0.62}, {0.7, 0.3, 0.7, 1}},
+	{{0.85, 0, 0.25, 0, 0.2, 0.45, 0.55, 0.4, 0.82, 0.55, 0.82, 0.82, 0.5, 1, 0.15, 0.92}},
+	{{0.75, 0.02, 0.4, 0.2, 0.2, 0.55, 0.22, 0.85, 0.5, 1, 0.8, 0.85, 0.8, 0.6, 0.5, 0.48, 0.22, 0.65}},
+	{{0.1, 0, 0.9, 0, 0.4, 1}},
+	{{0.5, 0.48, 0.2, 0.3, 0.25, 0.08, 0.5, 0, 0.75, 0.08, 0.8, 0.3, 0.5, 0.48, 0.18, 0.72, 0.25, 0.95, 0.5, 1, 0.75, 0.95, 0.82, 0.72, 0.5, 0.48}},
+	{{0.8, 0.35, 0.5, 0.5, 0.22, 0.38, 0.25, 0.1, 0.5, 0, 0.78, 0.12, 0.8, 0.35, 0.7, 1}},
+}
+
+// Sheet is what is pre-printed on one answer sheet, empty values are left for the student
+type Sheet struct {
+	TestID string
+	TestName string
+	UserID string
+	FullName string
+	Class string
+	Variant string
+}
+
+// sheetPage converts parts of the page used by layouts to points
+type sheetPage struct {
+	*pdfWriter.Page
+	width, height float64
+}
+
+func (p *sheetPage) fillRect(rect formLayout.Rect) {
+	p.FillRect(rect.X*p.width, rect.Y*p.height, rect.W*p.width, rect.H*p.height)
+}
+
+// field draws a dashed field of the cells and pre-prints the value into them
+func (p *sheetPage) field(field *formLayout.Field, value string) {
+	x, y, w, h := field.X*p.width, field.Y*p.height, field.W*p.width, field.H*p.height
+	p.SetGray(0)
+	p.StrokeRect(x, y, w, h, LINE_WIDTH, DASH)
+	// dividers are shorter than the field, so they aren't taken for digits, free-form fields have none
+	cellWidth := w / float64(field.Cells)
+	for cell := 1; cell < field.Cells && !field.FreeForm; cell++ {
+		cx := x + cellWidth*float64(cell)
+		p.Line(cx, y+h*0.2, cx, y+h, LINE_WIDTH, 0)
+	}
+	for i, digit := range value {
+		if i >= field.Cells || digit < '0' || digit > '9' {
+			break
+		}
+		p.digit(x+cellWidth*float64(i)+cellWidth/2, y+h/2, h*0.6, int(digit-'0'))
+	}
+	// the box is solid, so it isn't mistaken for a cell
+	labelRight := x - LABEL_GAP
+	if field.Cancel != nil {
+		box := field.Cancel
+		p.StrokeRect(box.X*p.width, box.Y*p.height, box.W*p.width, box.H*p.height, LINE_WIDTH, 0)
+		labelRight = box.X*p.width - CANCEL_LABEL_GAP
+	}
+	if field.Label != "" {
+		size := h * LABEL_SIZE
+		p.SetGray(LABEL_GRAY)
+		p.Text(labelRight-pdfWriter.TextWidth(field.Label, size), y+h/2+size*0.35, size, pdfWriter.FONT_BOLD, field.Label)
+	}
+}
+
+// digit draws the digit of the height centered at (cx, cy)
+func (p *sheetPage) digit(cx, cy, height float64, digit int) {
+	width := height * 0.6
+	p.SetGray(0)
+	for _, stroke := range digitStrokes[digit] {
+		points := make([]float64, len(stroke))
+		for i := 0; i+1 < len(stroke); i += 2 {
+			points[i] = cx - width/2 + stroke[i]*width
+			points[i+1] = cy - height/2 + stroke[i+1]*height
+		}
+		p.Polyline(height*0.09, points...)
+	}
+}
+
+// code draws the timing row and the data row of the sheet code
+func (p *sheetPage) code(rect formLayout.Rect, bits []bool) {
+	cellW := rect.W / float64(len(bits))
+	cellH := rect.H / 2
+	p.SetGray(0)
+	for i, bit := range bits {
+		cell := formLayout.Rect{X: rect.X + cellW*float64(i), Y: rect.Y, W: cellW, H: cellH}
+		if sheetCode.TimingCell(i) {
+			p.fillRect(cell)
+		}
+		if bit {
+			cell.Y += cellH
+			p.fillRect(cell)
+		}
+	}
+}
+
+func drawSheet(doc *pdfWriter.Document, layout *formLayout.Layout, sheet *Sheet) error {
+	p := &sheetPage{Page: doc.AddPage(), width: doc.Width, height: doc.Height}
+
+	p.SetGray(0)
+	for _, square := range layout.Squares {
+		p.fillRect(square)
+	}
+
+	// test and student names are small, so they aren't taken for handwriting
+	caption := Transliterate(sheet.TestName)
+	if sheet.FullName != "" {
+		caption = Transliterate(fmt.Sprintf("%s, %s", sheet.FullName, sheet.Class)) + " - " + caption
+	}
+	size := layout.Caption.H * p.height
+	width := layout.Caption.W * p.width
+	p.SetGray(LABEL_GRAY)
+	// the hint takes the right end of the caption line
+	if layout.Cancellable() {
+		hintWidth := pdfWriter.TextWidth(CANCEL_HINT, size)
+		p.Text(layout.Caption.X*p.width+width-hintWidth, (layout.Caption.Y+layout.Caption.H)*p.height, size, pdfWriter.FONT_REGULAR, CANCEL_HINT)
+		width -= hintWidth + LABEL_GAP
+	}
+	letters := int(width / pdfWriter.TextWidth("0", size))
+	if letters < 0 {
+		letters = 0
+	}
+	if len([]rune(caption)) > letters {
+		caption = string([]rune(caption)[:letters])
+	}
+	p.Text(layout.Caption.X*p.width, (layout.Caption.Y+layout.Caption.H)*p.height, size, pdfWriter.FONT_BOLD, caption)
+
+	for i := range layout.Fields {
+		value := ""
+		switch layout.Fields[i].Role {
+		case formLayout.ROLE_USER_ID:
+			value = sheet.UserID
+		case formLayout.ROLE_TEST_ID:
+			value = sheet.TestID
+		case formLayout.ROLE_VARIANT:
+			// the variant is printed from the first cell of the field, blank cells around it don't matter
+			value = sheet.Variant
+		}
+		p.field(&layout.Fields[i], value)
+	}
+
+	// handwritten fields are read only when the code can't be
+	code := &sheetCode.Code{TestID: sheet.TestID, UserID: sheet.UserID, Page: 1}
+	if sheet.Variant != "" {
+		variant, err := strconv.Atoi(sheet.Variant)
+		if err != nil {
+			return err
+		}
+		code.Variant = variant
+	}
+	bits, err := sheetCode.Encode(code)
+	if err != nil {
+		return err
+	}
+	p.code(layout.Code, bits)
+	return nil
+}
+
+// GenerateSheets makes a PDF of the layout page size with a page for every sheet
+func GenerateSheets(layout *formLayout.Layout, sheets []Sheet) (*pdfWriter.Document, error) {
+	doc := pdfWriter.New(layout.Width*pdfWriter.MM, layout.Height*pdfWriter.MM)
+	for i := range sheets {
+		err := drawSheet(doc, layout, &sheets[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// AnswerSheetsHandler sends sheets of the test, /test/answerSheets/<id>?grade=7&letter=A pre-prints
+// a sheet for every student of the class, variants are given out in turns
+func AnswerSheetsHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	test, err := utils.GetTestByID(r.URL.Path[len("/test/answerSheets/"):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = utils.CheckTestRight(&test, username, utils.RIGHT_CHECK)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grade := strings.TrimSpace(r.FormValue("grade"))
+	letter := strings.TrimSpace(r.FormValue("letter"))
+	sheets := []Sheet{Sheet{TestID: test.ID, TestName: test.Name}}
+	if grade != "" {
+		students, err := utils.GetClassStudents(grade, letter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(students) == 0 {
+			http.Error(w, fmt.Sprintf("Class %s%s has no students", grade, letter), http.StatusNotFound)
+			return
+		}
+		sheets = make([]Sheet, len(students))
+		for i, student := range students {
+			sheets[i] = Sheet{
+				TestID: test.ID,
+				TestName: test.Name,
+				UserID: student.ID,
+				FullName: student.Surname + " " + student.Name,
+				Class: grade + letter,
+			}
+			if test.NumberOfVariants() > 1 {
+				sheets[i].Variant = fmt.Sprint(i%test.NumberOfVariants()+1)
+			}
+		}
+	}
+
+	layoutName := r.FormValue("layout")
+	if layoutName == "" {
+		layoutName = formLayout.DEFAULT_LAYOUT
+	}
+	layout, err := formLayout.GetLayout(layoutName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(test.Questions) > layout.Questions() {
+		http.Error(w, fmt.Sprintf("Paper %s has only %d answer fields, the test has %d questions", layout.Title, layout.Questions(), len(test.Questions)), http.StatusBadRequest)
+		return
+	}
+	doc, err := GenerateSheets(layout, sheets)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"sheets_%s%s%s.pdf\"", test.ID, grade, Transliterate(letter)))
+	doc.WriteTo(w)
+}
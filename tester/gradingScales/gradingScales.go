@@ -0,0 +1,122 @@
+package gradingScales
+
+import (
+	"net/http"
+	"net/url"
+	"tucklejudge/utils"
+	"strings"
+	"fmt"
+	"errors"
+)
+
+type ScaleUI struct {
+	Index int
+	Scale utils.GradingScale
+	IsDefault bool
+}
+
+type ScalesUI struct {
+	Scales []ScaleUI
+	Message string
+}
+
+func GradingScalesHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	scales, defaultName, err := utils.GetGradingScales()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := &ScalesUI{
+		Scales: make([]ScaleUI, len(scales)),
+		Message: r.URL.Query().Get("message"),
+	}
+	for i, scale := range scales {
+		page.Scales[i] = ScaleUI{
+			Index: i,
+			Scale: scale,
+			IsDefault: scale.Name == defaultName,
+		}
+	}
+	utils.RenderTemplate(w, "gradingScales", page)
+}
+
+// parseScale reads scale number i from the form, scales without a name are skipped
+func parseScale(r *http.Request, i string) (*utils.GradingScale, error) {
+	name := strings.Join(strings.Fields(r.FormValue("name"+i)), "_")
+	if name == "" || r.FormValue("delete"+i) == "on" {
+		return nil, nil
+	}
+	scale := &utils.GradingScale{
+		Name: name,
+		Percentage: r.FormValue("percentage"+i) == "on",
+		Marks: strings.Fields(r.FormValue("marks"+i)),
+	}
+	if len(scale.Marks) == 0 {
+		return nil, errors.New(fmt.Sprintf("Scale %s has no marks", name))
+	}
+	err := scale.ParseBounds(r.FormValue("bounds"+i))
+	if err != nil {
+		return nil, err
+	}
+	return scale, scale.Validate()
+}
+
+func GradingScalesSavingHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	oldScales, _, err := utils.GetGradingScales()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var scales []utils.GradingScale
+	names := make(map[string]bool)
+	// existing scales are numbered, the new one has empty suffix
+	indexes := make([]string, 0, len(oldScales)+1)
+	for i := range oldScales {
+		indexes = append(indexes, fmt.Sprint(i))
+	}
+	indexes = append(indexes, "")
+	for _, i := range indexes {
+		scale, err := parseScale(r, i)
+		if err != nil {
+			http.Redirect(w, r, "/admin/gradingScales?message="+url.QueryEscape(err.Error()), http.StatusFound)
+			return
+		}
+		if scale == nil {
+			continue
+		}
+		if names[scale.Name] {
+			http.Redirect(w, r, "/admin/gradingScales?message="+url.QueryEscape("Scale "+scale.Name+" is defined twice"), http.StatusFound)
+			return
+		}
+		names[scale.Name] = true
+		scales = append(scales, *scale)
+	}
+	if len(scales) == 0 {
+		http.Redirect(w, r, "/admin/gradingScales?message="+url.QueryEscape("At least one scale is needed"), http.StatusFound)
+		return
+	}
+	defaultName := r.FormValue("default")
+	if !names[defaultName] {
+		defaultName = scales[0].Name
+	}
+	err = utils.SaveGradingScales(scales, defaultName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/gradingScales", http.StatusFound)
+}
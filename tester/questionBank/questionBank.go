@@ -0,0 +1,270 @@
+package questionBank
+
+import (
+	"net/http"
+	"net/url"
+	"tucklejudge/tester/testCreator"
+	"tucklejudge/utils"
+	"strconv"
+	"strings"
+	"fmt"
+	"errors"
+)
+
+type BankQuestionUI struct {
+	Question utils.BankQuestion
+	Stats utils.BankQuestionStats
+	Editable bool
+}
+
+type BankUI struct {
+	Questions []BankQuestionUI
+	Tags []string // all tags of the visible questions
+	Tag string
+	Difficulty int // 0 means any difficulty
+	Difficulties []int
+	Edited utils.BankQuestion // question in the adding/editing form
+	Scales []utils.GradingScale
+	DefaultScale string
+	Message string
+}
+
+func redirectWithMessage(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/bank/?message="+url.QueryEscape(message), http.StatusFound)
+}
+
+func QuestionBankHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	questions, err := utils.GetBankQuestions(username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := &BankUI{
+		Tag: strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag"))),
+		Message: r.URL.Query().Get("message"),
+		Edited: utils.BankQuestion{Points: 1, Credit: utils.CREDIT_ALL, Difficulty: utils.MIN_DIFFICULTY},
+	}
+	page.Difficulty, _ = strconv.Atoi(r.URL.Query().Get("difficulty"))
+	for d := utils.MIN_DIFFICULTY; d <= utils.MAX_DIFFICULTY; d++ {
+		page.Difficulties = append(page.Difficulties, d)
+	}
+	page.Scales, page.DefaultScale, err = utils.GetGradingScales()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	seenTags := make(map[string]bool)
+	editID := r.URL.Query().Get("edit")
+	for _, q := range questions {
+		for _, tag := range q.Tags {
+			if !seenTags[tag] {
+				seenTags[tag] = true
+				page.Tags = append(page.Tags, tag)
+			}
+		}
+		if q.ID == editID && q.Owner == username {
+			page.Edited = q
+		}
+		if page.Tag != "" && !q.HasTag(page.Tag) || page.Difficulty != 0 && q.Difficulty != page.Difficulty {
+			continue
+		}
+		page.Questions = append(page.Questions, BankQuestionUI{
+			Question: q,
+			Stats: q.Stats(),
+			Editable: q.Owner == username,
+		})
+	}
+	utils.RenderTemplate(w, "questionBank", page)
+}
+
+// getBankQuestionFromForm parses the adding/editing form, answers are written on the sheet so only digits are allowed
+func getBankQuestionFromForm(r *http.Request) (*utils.BankQuestion, error) {
+	q := &utils.BankQuestion{
+		ID: r.FormValue("id"),
+		Shared: r.FormValue("shared") == "on",
+		Answer: strings.TrimSpace(r.FormValue("answer")),
+		Credit: r.FormValue("credit"),
+		Tags: utils.ParseTags(r.FormValue("tags")),
+	}
+	if q.ID != "" && !utils.IsBankQuestionID(q.ID) {
+		return nil, errors.New("Wrong bank question ID " + q.ID)
+	}
+	if len(q.Answer) == 0 || len(q.Answer) > 8 {
+		return nil, errors.New("Answer must contain from 1 to 8 digits")
+	}
+	for _, c := range q.Answer {
+		if c < '0' || c > '9' {
+			return nil, errors.New(fmt.Sprintf("Answer %s contains not only digits", q.Answer))
+		}
+	}
+	var err error
+	q.Points, err = strconv.Atoi(r.FormValue("points"))
+	if err != nil || q.Points < 0 {
+		return nil, errors.New("Points must be a non-negative number")
+	}
+	q.Penalty, err = strconv.Atoi(r.FormValue("penalty"))
+	if err != nil || q.Penalty < 0 {
+		return nil, errors.New("Penalty must be a non-negative number")
+	}
+	if !utils.IsValidCredit(q.Credit) {
+		q.Credit = utils.CREDIT_ALL
+	}
+	q.Difficulty, err = strconv.Atoi(r.FormValue("difficulty"))
+	if err != nil || q.Difficulty < utils.MIN_DIFFICULTY || q.Difficulty > utils.MAX_DIFFICULTY {
+		return nil, errors.New(fmt.Sprintf("Difficulty must be from %d to %d", utils.MIN_DIFFICULTY, utils.MAX_DIFFICULTY))
+	}
+	return q, nil
+}
+
+func QuestionSavingHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q, err := getBankQuestionFromForm(r)
+	if err != nil {
+		redirectWithMessage(w, r, err.Error())
+		return
+	}
+	// only the owner can change the question
+	if q.ID != "" {
+		previous, err := utils.GetBankQuestion(q.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if previous.Owner != username {
+			redirectWithMessage(w, r, "Only the author can edit question #"+q.ID)
+			return
+		}
+	}
+	q.Owner = username
+	err = utils.SaveBankQuestion(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/bank/", http.StatusFound)
+}
+
+func QuestionDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := r.URL.Path[len("/bank/deleteQuestion/process/"):]
+	if !utils.IsBankQuestionID(id) {
+		http.Error(w, "Wrong bank question ID "+id, http.StatusBadRequest)
+		return
+	}
+	q, err := utils.GetBankQuestion(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if q.Owner != username {
+		redirectWithMessage(w, r, "Only the author can delete question #"+id)
+		return
+	}
+	// tests keep their copies of the question, only the link to statistics is lost
+	err = utils.DeleteBankQuestion(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/bank/", http.StatusFound)
+}
+
+// TestAssemblyHandler creates a test of the picked bank questions in the order they are listed
+func TestAssemblyHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.ParseForm()
+	picked := r.Form["pick"]
+	if len(picked) == 0 {
+		redirectWithMessage(w, r, "No questions are picked")
+		return
+	}
+	if len(picked) > testCreator.NUMBER_OF_QUESTIONS {
+		redirectWithMessage(w, r, fmt.Sprintf("Test can't have more than %d questions", testCreator.NUMBER_OF_QUESTIONS))
+		return
+	}
+
+	test := utils.Test{
+		Name: strings.TrimSpace(r.FormValue("testName")),
+		Questions: make([]utils.Question, len(picked)),
+		Owner: username,
+	}
+	for i, id := range picked {
+		if !utils.IsBankQuestionID(id) {
+			http.Error(w, "Wrong bank question ID "+id, http.StatusBadRequest)
+			return
+		}
+		q, err := utils.GetBankQuestion(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !q.VisibleTo(username) {
+			redirectWithMessage(w, r, "Question #"+id+" is not shared")
+			return
+		}
+		test.Questions[i] = q.ToQuestion()
+	}
+	test.Scale, err = utils.GetGradingScale(r.FormValue("scale"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = test.CreateIDAndSave()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = utils.AddTestToUsersList(username, test.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// variants and sections are set in the editor
+	http.Redirect(w, r, "/test/editTest/"+test.ID, http.StatusFound)
+}
@@ -0,0 +1,32 @@
+package testChecker
+
+import (
+	"net/http"
+	"tucklejudge/utils"
+)
+
+// DebugBundleHandler shows how a page was recognized, only the teacher who checked the page can see it
+func DebugBundleHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bundle, err := utils.GetDebugBundle(r.URL.Path[len("/test/debugBundle/"):])
+	if err != nil {
+		http.Error(w, "There is no debug bundle of the page", http.StatusNotFound)
+		return
+	}
+	if bundle.Teacher != username {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	utils.RenderTemplate(w, "debugBundle", bundle)
+}
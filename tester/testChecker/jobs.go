@@ -0,0 +1,207 @@
+package testChecker
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"tucklejudge/fieldsRecognition"
+	"tucklejudge/utils"
+)
+
+// CHECK_WORKERS jobs are run at the same time, the rest wait in the queue
+const CHECK_WORKERS = 2
+const CHECK_QUEUE_SIZE = 256
+
+var ErrTooManyChecks = errors.New("Too many checks are waiting, try again later")
+
+var ErrCheckInProgress = errors.New("The previous check of the test isn't finished yet")
+
+var checkQueue = make(chan string, CHECK_QUEUE_SIZE)
+
+// checksStartingMutex makes looking for an unfinished job of the check and queueing a new one atomic
+var checksStartingMutex sync.Mutex
+
+// StartCheckWorkers starts the workers and queues again the jobs which weren't finished before the restart
+func StartCheckWorkers() error {
+	ids, err := utils.GetUnfinishedCheckJobs()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < CHECK_WORKERS; i++ {
+		go checkWorker()
+	}
+	go func() {
+		for _, id := range ids {
+			checkQueue <- id
+		}
+	}()
+	return nil
+}
+
+func enqueueCheckJob(teacher, checkID, fileName, layoutName string, threshold float64, debug bool) (*utils.CheckJob, error) {
+	utils.UserFilesMutex.Lock()
+	id, err := utils.GetCurrentlyFreeID(utils.CHECK_JOBS_FOLDER, 8)
+	utils.UserFilesMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	job := &utils.CheckJob{
+		ID: id,
+		Teacher: teacher,
+		CheckID: checkID,
+		FileName: fileName,
+		Layout: layoutName,
+		Threshold: threshold,
+		Status: utils.JOB_QUEUED,
+		Debug: debug,
+	}
+	err = utils.SaveCheckJob(job)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case checkQueue <- job.ID:
+		return job, nil
+	default:
+		job.Status = utils.JOB_FAILED
+		job.Error = ErrTooManyChecks.Error()
+		err = utils.SaveCheckJob(job)
+		if err != nil {
+			return nil, err
+		}
+		return nil, ErrTooManyChecks
+	}
+}
+
+func checkWorker() {
+	for id := range checkQueue {
+		job, err := utils.GetCheckJob(id)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		err = checkPages(job)
+		job.Status = utils.JOB_DONE
+		if err != nil {
+			job.Status = utils.JOB_FAILED
+			job.Error = err.Error()
+		}
+		err = utils.SaveCheckJob(job)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// checkPages checks the pages which weren't checked yet, the results are saved after every page
+func checkPages(job *utils.CheckJob) error {
+	job.Status = utils.JOB_RUNNING
+	// the file is opened once for all the pages of the job
+	pages, err := fieldsRecognition.OpenPages("src/" + job.FileName)
+	if err != nil {
+		return err
+	}
+	defer pages.Close()
+	if len(job.Pages) == 0 {
+		job.Pages = make([]utils.JobPage, pages.Count())
+		for i := range job.Pages {
+			job.Pages[i].Status = utils.JOB_QUEUED
+		}
+	}
+	err = utils.SaveCheckJob(job)
+	if err != nil {
+		return err
+	}
+	// pages are recognized in parallel as far as fieldsRecognition allows, the job is updated by one page at a time
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	var jobErr error
+	for i := range job.Pages {
+		// pages checked before a restart are kept
+		if job.Pages[i].Status == utils.JOB_DONE || job.Pages[i].Status == utils.JOB_FAILED {
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := fieldsRecognition.BringTestResultsFromPage(pages, i, job.Layout, job.Debug)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				jobErr = err
+				return
+			}
+			err = checkPage(job, i, &result)
+			if err != nil {
+				jobErr = err
+			}
+		}(i)
+	}
+	wg.Wait()
+	return jobErr
+}
+
+// checkPage grades the recognized page and saves the job and the results checked so far
+func checkPage(job *utils.CheckJob, i int, result *fieldsRecognition.PageResult) error {
+	page := &job.Pages[i]
+	if result.Debug != nil {
+		result.Debug.Teacher = job.Teacher
+		err := utils.SaveDebugBundle(result.Debug)
+		if err != nil {
+			return err
+		}
+	}
+	err := result.Err
+	var res *utils.PersonalResult
+	if err == nil {
+		res, err = createProtocol(result, job.Teacher, job.Threshold)
+	}
+	// pages that weren't graded are listed with the reason
+	if err != nil {
+		page.Status = utils.JOB_FAILED
+		page.Failure = &utils.PageFailure{Page: i+1, ImageName: result.InputImage, Reason: err.Error()}
+	} else {
+		page.Status = utils.JOB_DONE
+		page.Result = res
+	}
+	err = utils.SaveShortResultsInfoToFile(job.CheckID, job.ShortResults())
+	if err != nil {
+		return err
+	}
+	return utils.SaveCheckJob(job)
+}
+
+// CheckJobHandler shows the progress of the job, the page is reloaded until the job is finished
+func CheckJobHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id := r.URL.Path[len("/test/checkJob/"):]
+	if id == "" || strings.ContainsAny(id, "/\\.") {
+		http.Error(w, "Wrong check job "+id, http.StatusBadRequest)
+		return
+	}
+	job, err := utils.GetCheckJob(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// jobs are visible only to the teacher who started them
+	if job.Teacher != username {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	for _, page := range job.Pages {
+		if page.Failure != nil {
+			page.Failure.DebugBundleForTemplate = utils.VisibleDebugBundle(page.Failure.ImageName, username)
+		}
+	}
+	utils.RenderTemplate(w, "checkJob", job)
+}
@@ -0,0 +1,117 @@
+package testChecker
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"tucklejudge/utils"
+)
+
+func ReviewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	queue, err := utils.GetReviewQueue(username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	utils.RenderTemplate(w, "reviewQueue", queue)
+}
+
+// reviewedResult returns the test ID and the student of the result from the path after the prefix,
+// only teachers with the check right for the test can review its results
+func reviewedResult(w http.ResponseWriter, r *http.Request, prefix string) (string, string, bool) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return "", "", false
+	}
+	info := strings.Split(r.URL.Path[len(prefix):], "$")
+	if len(info) != 2 {
+		http.Error(w, "Wrong result "+r.URL.Path, http.StatusBadRequest)
+		return "", "", false
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	test, err := utils.GetTestByID(info[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", "", false
+	}
+	err = utils.CheckTestRight(&test, username, utils.RIGHT_CHECK)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return "", "", false
+	}
+	return info[0], info[1], true
+}
+
+// ResultApprovalHandler shows the mark of a reviewed result to the student
+func ResultApprovalHandler(w http.ResponseWriter, r *http.Request) {
+	testID, student, ok := reviewedResult(w, r, "/test/approveResult/process/")
+	if !ok {
+		return
+	}
+	err := utils.ApproveResult(testID, student)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/test/reviewQueue", http.StatusFound)
+}
+
+// ResultReviewHandler shows the recognized fields of the sheet next to their crops
+func ResultReviewHandler(w http.ResponseWriter, r *http.Request) {
+	testID, student, ok := reviewedResult(w, r, "/test/reviewResult/")
+	if !ok {
+		return
+	}
+	results, err := utils.GetTestUsersResultByID(testID, student)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	results.TestIDForTemplate = testID
+	// results checked before sheets were kept have only the processed image
+	if results.NormalizedImageName == "" {
+		results.NormalizedImageName = results.ProcessedImageName
+	}
+	utils.RenderTemplate(w, "reviewResult", results)
+}
+
+// ResultCorrectionHandler regrades the result with the values corrected by the teacher
+func ResultCorrectionHandler(w http.ResponseWriter, r *http.Request) {
+	testID, student, ok := reviewedResult(w, r, "/test/reviewResult/process/")
+	if !ok {
+		return
+	}
+	results, err := utils.GetTestUsersResultByID(testID, student)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.ParseForm()
+	corrections := make(map[int]string)
+	for i := range results.Fields {
+		if value, ok := r.PostForm[fmt.Sprintf("field%d", i)]; ok && results.Fields[i].Editable() {
+			corrections[i] = value[0]
+		}
+	}
+	_, err = utils.CorrectResult(testID, student, corrections)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/test/view/"+testID+"$"+student, http.StatusFound)
+}
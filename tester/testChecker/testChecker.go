@@ -1,21 +1,29 @@
 package testChecker
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"tucklejudge/fieldsRecognition"
 	"tucklejudge/utils"
-	"strings"
-	"fmt"
+	"tucklejudge/utils/formLayout"
 )
 
-func createProtocol(input []string, inputPictureName, processedPictureName string) (*utils.PersonalResult, error) {
-	userID := input[0]
+// createProtocol grades the sheet, sheets read less confidently than the threshold wait for review
+func createProtocol(page *fieldsRecognition.PageResult, teacher string, threshold float64) (*utils.PersonalResult, error) {
+	input := page.Values
+	userID := input.UserID
 	// userID := "0001"
-	testID := input[1]
+	testID := input.TestID
 	test, err := utils.GetTestByID(testID)
 	if err != nil {
 		return nil, err
 	}
+	err = utils.CheckTestRight(&test, teacher, utils.RIGHT_CHECK)
+	if err != nil {
+		return nil, err
+	}
 	username, err := utils.GetUsernameByID(userID)
 	if err != nil {
 		return nil, err
@@ -24,49 +32,38 @@ func createProtocol(input []string, inputPictureName, processedPictureName strin
 	if err != nil {
 		return nil, err
 	}
+	// all answers of the sheet are kept, a later version of the key may have more questions
+	answers := append([]string{}, input.Answers...)
 	results := &utils.PersonalTest {
 		UserName: username,
-		TestName: test.Name,
-		InputImageName: inputPictureName,
-		ProcessedImageName: processedPictureName,
-		Questions: make([]utils.PersonalQuestion, len(test.Questions)),
-	}
-	numericPointsSum := 0
-	for i, q := range test.Questions {
-		ind := 2
-		if i < 15 {
-			ind += 2*i
-		} else {
-			ind += 2*(i-15)+1
-		}
-		userAnswer := input[ind]
-		results.Questions[i].Index = fmt.Sprint(i+1)
-		if len(userAnswer) < len(q.Answer) {
-			results.Questions[i].UserAnswer = userAnswer
-		} else {
-			results.Questions[i].UserAnswer = userAnswer[:len(q.Answer)]
-		}
-		results.Questions[i].CorrectAnswer = q.Answer
-		results.Questions[i].Points = "0"
-		if (q.Answer == results.Questions[i].UserAnswer) {
-			results.Questions[i].Points = fmt.Sprint(q.Points)
-			numericPointsSum += q.Points
-		}
+		InputImageName: page.InputImage,
+		ProcessedImageName: page.ProcessedImage,
+		NormalizedImageName: page.NormalizedImage,
+		Fields: utils.RecognizedFields(input.Fields),
 	}
-	results.PointsSum = fmt.Sprint(numericPointsSum)
-	mark := 5
-	for i, points := range test.PointsToMark {
-		results.PointsToMark[i] = fmt.Sprint(points)
-		if (numericPointsSum < points && mark == 5) {
-			mark = i+2
-		}
+	// a sheet of an unknown variant is graded against the first key until the teacher corrects the variant
+	variant, variantErr := test.ParseVariant(input.Variant)
+	if variantErr != nil {
+		variant = 1
+	}
+	utils.GradeAnswers(&test, variant, answers, results)
+	results.Review = input.LowConfidence(threshold, len(test.Questions), test.NumberOfVariants())
+	if variantErr != nil {
+		results.Review = append(results.Review, "variant unknown: "+formLayout.ShowBlanks(input.Variant))
+	}
+	// the fields of a distorted photo may be cut wrong even when every digit is read confidently
+	if page.Residual > fieldsRecognition.MAX_RESIDUAL {
+		results.Review = append(results.Review, fmt.Sprintf("the photo is distorted, marks are off by %.1f pixels", page.Residual))
 	}
-	results.Mark = fmt.Sprint(mark)
 
 	err = utils.CreateTestResultFile(testID+"$"+username, results)
 	if err != nil {
 		return nil, err
 	}
+	err = utils.RecordBankStatistics(&test, results)
+	if err != nil {
+		return nil, err
+	}
 	err = utils.AddTestToUsersList(username, testID)
 	if err != nil {
 		return nil, err
@@ -77,11 +74,14 @@ func createProtocol(input []string, inputPictureName, processedPictureName strin
 		Username: username,
 		FullName: user.Surname + " " + user.Name,
 		Mark: results.Mark,
+		Variant: results.Variant,
+		NeedsReview: len(results.Review) > 0,
 	}
 	return short_result, nil
 }
 
-func checkTestsAndRenderTemplate(w http.ResponseWriter, r *http.Request, string_id string) {
+// startCheck saves the uploaded file and queues the job which checks it
+func startCheck(w http.ResponseWriter, r *http.Request, string_id string) {
 	if utils.CheckForValidStandardAccess(w, r) == false {
 		return
 	}
@@ -89,56 +89,81 @@ func checkTestsAndRenderTemplate(w http.ResponseWriter, r *http.Request, string_
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
-
-	fileName, err := utils.SaveFormFileToSrc(r)
+	username, err := utils.GetUsername(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// getting file extension
-	strsForGettingCorrectExtension := strings.Split(fileName, ".")
-	ext := strsForGettingCorrectExtension[1]
-
-	// applying fieldsRecognition on particular extension
-	var inputInfo [][]string
-	var imagesNames [][]string
-	if ext == "pdf" {
-		inputInfo, imagesNames = fieldsRecognition.BringTestResultsFromPDFs("src/"+fileName)
-	} else {
-		inputInfo = make([][]string, 1)
-		imagesNames = make([][]string, 1)
-		inputInfo[0], imagesNames[0] = fieldsRecognition.BringTestResultsFromPhoto("src/"+fileName, ext)
+	// only the teacher who made the check can redo it
+	if string_id != "" {
+		user, err := utils.GetAccauntInfo(username)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		found := false
+		for _, id := range user.Tests {
+			found = found || id == string_id
+		}
+		if !found {
+			http.Error(w, "Check "+string_id+" belongs to another teacher", http.StatusForbidden)
+			return
+		}
 	}
 
-	testingInfo := &utils.ShortTestResultsInfo {
-		Results: make([]utils.PersonalResult, 0), //len(inputInfo)
-	}
-	for i, str := range inputInfo {
-		// imagesNames = append(imagesNames, []string{fileName, fileName}) // TODO make redundant
-		res, err := createProtocol(str, imagesNames[i][0], imagesNames[i][1])
+	// the form is checked before the upload is saved, so a wrong form leaves no file behind,
+	// empty layout means it's chosen for every page by its squares
+	layoutName := r.FormValue("layout")
+	if layoutName != "" {
+		_, err = formLayout.GetLayout(layoutName)
 		if err != nil {
-			continue;
-			// http.Error(w, err.Error(), http.StatusInternalServerError)
-			// return
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		res.IndexForTemplate = i+1
-		testingInfo.Results = append(testingInfo.Results, *res)
+	}
+	threshold, err := utils.ParseReviewThreshold(r.FormValue("threshold"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileName, err := utils.SaveFormFileToSrc(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// a file with too many pages is refused before it's queued
+	_, err = fieldsRecognition.CountPages("src/" + fileName)
+	if errors.Is(err, fieldsRecognition.ErrTooLarge) {
+		os.Remove("src/" + fileName)
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
 	}
 	if string_id == "" {
+		utils.UserFilesMutex.Lock()
 		string_id, err = utils.GetCurrentlyFreeID("tester/teacherTestResults", 6)
+		utils.UserFilesMutex.Unlock()
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
-	testingInfo.IDForTemplate = string_id
-	err = utils.SaveShortResultsInfoToFile(string_id, testingInfo)
+	// a check has one job at a time, or the older job would overwrite results of the newer one
+	checksStartingMutex.Lock()
+	defer checksStartingMutex.Unlock()
+	unfinished, err := utils.GetUnfinishedJobOfCheck(string_id)
 	if err != nil {
+		os.Remove("src/" + fileName)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	username, err := utils.GetUsername(r)
+	if unfinished != "" {
+		os.Remove("src/" + fileName)
+		http.Error(w, ErrCheckInProgress.Error()+", see /test/checkJob/"+unfinished, http.StatusConflict)
+		return
+	}
+	// results of the previous check are replaced by the ones of the job
+	err = utils.SaveShortResultsInfoToFile(string_id, &utils.ShortTestResultsInfo{})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -148,14 +173,23 @@ func checkTestsAndRenderTemplate(w http.ResponseWriter, r *http.Request, string_
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	utils.RenderTemplate(w, "testChecker", testingInfo)
+	// pages are recognized in the background, the teacher watches the progress of the job
+	job, err := enqueueCheckJob(username, string_id, fileName, layoutName, threshold, r.FormValue("debug") == "on")
+	if errors.Is(err, ErrTooManyChecks) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/test/checkJob/"+job.ID, http.StatusSeeOther)
 }
 
 func TestCheckHandler(w http.ResponseWriter, r *http.Request) {
-	checkTestsAndRenderTemplate(w, r, "")
+	startCheck(w, r, "")
 }
 
 func TestRecheckHandler(w http.ResponseWriter, r *http.Request) {
 	string_id := r.URL.Path[len("/test/recheckTest/"):]
-	checkTestsAndRenderTemplate(w, r, string_id)
+	startCheck(w, r, string_id)
 }
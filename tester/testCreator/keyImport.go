@@ -0,0 +1,112 @@
+package testCreator
+
+import (
+	"net/http"
+	"tucklejudge/utils"
+	"strings"
+)
+
+type KeyImportUI struct {
+	FileName string
+	Errors []utils.KeyRowError
+}
+
+// TestImportHandler creates a test from the uploaded CSV or JSON key, nothing is saved when any row is invalid
+func TestImportHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	if !utils.CheckForTeacher(r) {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	in, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer in.Close()
+
+	test, errs := utils.ParseKey(header.Filename, in)
+	if len(errs) > 0 {
+		utils.RenderTemplate(w, "testImport", &KeyImportUI{FileName: header.Filename, Errors: errs})
+		return
+	}
+	// name and scale chosen in the form are more important than the ones of the file
+	if name := strings.TrimSpace(r.FormValue("testName")); name != "" {
+		test.Name = name
+	}
+	scaleName := r.FormValue("scale")
+	if scaleName == "" {
+		scaleName = test.Scale.Name
+	}
+	test.Scale, err = utils.GetGradingScale(scaleName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	test.Owner = username
+	err = test.CreateIDAndSave()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = utils.AddTestToUsersList(username, test.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/test/editTest/"+test.ID, http.StatusFound)
+}
+
+// TestExportHandler sends the key as /test/exportTest/<id>.csv or /test/exportTest/<id>.json
+func TestExportHandler(w http.ResponseWriter, r *http.Request) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fileName := r.URL.Path[len("/test/exportTest/"):]
+	strs := strings.Split(fileName, ".")
+	if len(strs) != 2 {
+		http.Error(w, "Export file must be <test id>.csv or <test id>.json", http.StatusBadRequest)
+		return
+	}
+	test, err := utils.GetTestByID(strs[0])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	err = utils.CheckTestRight(&test, username, utils.RIGHT_VIEW)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var out []byte
+	switch strs[1] {
+	case "csv":
+		out, err = utils.ExportKeyCSV(&test)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case "json":
+		out, err = utils.ExportKeyJSON(&test)
+		w.Header().Set("Content-Type", "application/json")
+	default:
+		http.Error(w, "Unknown export format "+strs[1], http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\"test_"+fileName+"\"")
+	w.Write(out)
+}
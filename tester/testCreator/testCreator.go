@@ -3,11 +3,83 @@ package testCreator
 import (
 	"net/http"
 	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
 	"strconv"
+	"strings"
 	"fmt"
 )
 
-const NUMBER_OF_QUESTIONS = 30
+const NUMBER_OF_QUESTIONS = utils.MAX_QUESTIONS
+
+// getBankIDFromForm returns the bank question the question i was taken from, only questions of the bank
+// visible to the teacher can be linked, the links the test had before are kept for its collaborators
+func getBankIDFromForm(r *http.Request, i int, username string, previous *utils.Test) string {
+	id := r.FormValue(fmt.Sprintf("bank%d", i+1))
+	if !utils.IsBankQuestionID(id) {
+		return ""
+	}
+	if previous != nil {
+		for _, q := range previous.Questions {
+			if q.BankID == id {
+				return id
+			}
+		}
+	}
+	q, err := utils.GetBankQuestion(id)
+	if err != nil || !q.VisibleTo(username) {
+		return ""
+	}
+	return id
+}
+
+// getTestFromForm parses test creator/editor form, previous is the edited test or nil for a new one
+func getTestFromForm(r *http.Request, username string, previous *utils.Test) (utils.Test, error) {
+	var test utils.Test
+	test.Name = r.FormValue("testName")
+	n, _ := strconv.Atoi(r.FormValue("numberOfQuestions"))
+	variants, _ := strconv.Atoi(r.FormValue("numberOfVariants"))
+	if variants < 1 || variants > utils.MAX_VARIANTS {
+		variants = 1
+	}
+	test.Questions = make([]utils.Question, n)
+	for i, _ := range test.Questions {
+		q := &test.Questions[i]
+		q.Answers = make([]string, variants)
+		for v := range q.Answers {
+			q.Answers[v] = r.FormValue(fmt.Sprintf("answer%d_%d", i+1, v))
+		}
+		q.Answer = q.Answers[0]
+		q.Points, _ = strconv.Atoi(r.FormValue(fmt.Sprintf("points%d", i+1)))
+		q.Credit = r.FormValue(fmt.Sprintf("credit%d", i+1))
+		if !utils.IsValidCredit(q.Credit) {
+			q.Credit = utils.CREDIT_ALL
+		}
+		q.Penalty, _ = strconv.Atoi(r.FormValue(fmt.Sprintf("penalty%d", i+1)))
+		// section name is saved as a single word, '#' marks the bank ID in the test file
+		q.Section = strings.TrimLeft(strings.Join(strings.Fields(r.FormValue(fmt.Sprintf("section%d", i+1))), "_"), "#")
+		q.BankID = getBankIDFromForm(r, i, username, previous)
+	}
+	scale, err := utils.GetGradingScale(r.FormValue("scale"))
+	if err != nil {
+		return test, err
+	}
+	// custom bounds are ignored when another scale has just been chosen in the editor
+	bounds := strings.TrimSpace(r.FormValue("bounds"))
+	previousScale := r.FormValue("previousScale")
+	if bounds != "" && (previousScale == "" || previousScale == scale.Name) {
+		scale.Percentage = r.FormValue("percentage") == "on"
+		err = scale.ParseBounds(bounds)
+		if err != nil {
+			return test, err
+		}
+		err = scale.Validate()
+		if err != nil {
+			return test, err
+		}
+	}
+	test.Scale = scale
+	return test, nil
+}
 
 func TestEditHandler(w http.ResponseWriter, r *http.Request) {
 	if utils.CheckForValidStandardAccess(w, r) == false {
@@ -17,25 +89,65 @@ func TestEditHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	testID := r.URL.Path[len("/test/editTest/"):]
 	test, err := utils.GetTestByID(testID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	err = utils.CheckTestRight(&test, username, utils.RIGHT_VIEW)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	test.RightForTemplate = utils.GetTestRight(&test, username)
+	test.CollaboratorRightsForTemplate = utils.CollaboratorRights
 	test.NumberOfQuestionsForTemplate = len(test.Questions)
+	test.NumberOfVariantsForTemplate = test.NumberOfVariants()
+	test.ChangeLogForTemplate, err = utils.GetTestChangeLog(testID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	test.ScalesForTemplate, _, err = utils.GetGradingScales()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	test.LayoutsForTemplate, err = formLayout.GetLayouts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	test.VariantsForTemplate = make([]int, utils.MAX_VARIANTS)
+	for v := range test.VariantsForTemplate {
+		test.VariantsForTemplate[v] = v+1
+	}
+
+	for i := range test.Questions {
+		for len(test.Questions[i].Answers) < utils.MAX_VARIANTS {
+			test.Questions[i].Answers = append(test.Questions[i].Answers, "")
+		}
+	}
 
 	for i := len(test.Questions); i < NUMBER_OF_QUESTIONS; i++ {
 		test.Questions = append(test.Questions, utils.Question{
 			Answer: "",
+			Answers: make([]string, utils.MAX_VARIANTS),
 			Points: 1,
+			Credit: utils.CREDIT_ALL,
 		})
 	}
 	for i := range test.Questions {
 		test.Questions[i].IndexForTemplate = i+1
 	}
 
-	utils.RenderTemplate(w, "testEditor", test)
+	utils.RenderTemplate(w, "testEditor", &test)
 }
 
 func TestCreatorHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,10 +163,25 @@ func TestCreatorHandler(w http.ResponseWriter, r *http.Request) {
 	for i := range questions_iterator {
 		questions_iterator[i] = i+1
 	}
+	variants_iterator := make([]int, utils.MAX_VARIANTS)
+	for i := range variants_iterator {
+		variants_iterator[i] = i+1
+	}
+	scales, defaultScale, err := utils.GetGradingScales()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	test := struct {
 		Questions []int
+		Variants []int
+		Scales []utils.GradingScale
+		DefaultScale string
 	}{
 		Questions: questions_iterator,
+		Variants: variants_iterator,
+		Scales: scales,
+		DefaultScale: defaultScale,
 	}
 	utils.RenderTemplate(w, "testCreator", test)
 }
@@ -68,31 +195,36 @@ func CreationProcessHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var test utils.Test
-	test.Name = r.FormValue("testName")
-	n, _ := strconv.Atoi(r.FormValue("numberOfQuestions"))
-	test.Questions = make([]utils.Question, n)
-	for i, _ := range test.Questions {
-		test.Questions[i].Answer = r.FormValue(fmt.Sprintf("answer%d", i+1))
-		test.Questions[i].Points, _ = strconv.Atoi(r.FormValue(fmt.Sprintf("points%d", i+1)))
-	}
-	for i, _ := range test.PointsToMark {
-		test.PointsToMark[i], _ = strconv.Atoi(r.FormValue(fmt.Sprintf("pointsTo%d", i+2)))
-	}
-	err := test.CreateIDAndSave()
+	username, err := utils.GetUsername(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	username, err := utils.GetUsername(r)
+	test, err := getTestFromForm(r, username, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	test.Owner = username
+	err = test.CreateIDAndSave()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	utils.AddTestToUsersList(username, test.ID)
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+type RegradeUI struct {
+	TestID string
+	TestName string
+	Version int
+	Changes []string
+	Changed []utils.RegradedResult
+	Unchanged int
+	NotRegraded []utils.RegradedResult
+}
+
 func SavingProcessHandler(w http.ResponseWriter, r *http.Request) {
 	if utils.CheckForValidStandardAccess(w, r) == false {
 		return
@@ -101,31 +233,70 @@ func SavingProcessHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusFound)
 		return
 	}
-	
-	var test utils.Test
-	test.ID = r.URL.Path[len("/test/saveTest/process/"):]
-	test.Name = r.FormValue("testName")
-	n, _ := strconv.Atoi(r.FormValue("numberOfQuestions"))
-	test.Questions = make([]utils.Question, n)
-	for i, _ := range test.Questions {
-		test.Questions[i].Answer = r.FormValue(fmt.Sprintf("answer%d", i+1))
-		test.Questions[i].Points, _ = strconv.Atoi(r.FormValue(fmt.Sprintf("points%d", i+1)))
+
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	for i, _ := range test.PointsToMark {
-		test.PointsToMark[i], _ = strconv.Atoi(r.FormValue(fmt.Sprintf("pointsTo%d", i+2)))
+	previous, err := utils.GetTestByID(r.URL.Path[len("/test/saveTest/process/"):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	err = utils.CheckTestRight(&previous, username, utils.RIGHT_EDIT)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	test, err := getTestFromForm(r, username, &previous)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	test.ID = previous.ID
+	// ownership isn't edited by the form, tests without an owner are claimed by the first teacher saving them
+	test.Owner = previous.Owner
+	if test.Owner == "" {
+		test.Owner = username
+	}
+	test.Collaborators = previous.Collaborators
+	test.Archived = previous.Archived
 
-
-	// saving test to file
-	err := utils.SaveTestToFile(&test)
+	// saving new version of the test
+	changes, err := utils.SaveNewTestVersion(&test)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusFound)
+	// regrading results checked with the previous key
+	regrade := &RegradeUI{
+		TestID: test.ID,
+		TestName: test.Name,
+		Version: test.Version,
+		Changes: changes,
+	}
+	if len(changes) > 0 {
+		results, err := utils.RegradeTestResults(&test)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, result := range results {
+			if !result.Regraded {
+				regrade.NotRegraded = append(regrade.NotRegraded, result)
+			} else if result.OldMark != result.NewMark || result.OldPoints != result.NewPoints {
+				regrade.Changed = append(regrade.Changed, result)
+			} else {
+				regrade.Unchanged++
+			}
+		}
+	}
+	utils.RenderTemplate(w, "testRegrade", regrade)
 }
 
+// TestDeletionHandler deletes the test of the owner, other teachers only remove it from their lists
 func TestDeletionHandler(w http.ResponseWriter, r *http.Request) {
 	if utils.CheckForValidStandardAccess(w, r) == false {
 		return
@@ -136,7 +307,34 @@ func TestDeletionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	testID := r.URL.Path[len("/test/deleteTest/process/"):]
-	
+	test, err := utils.GetTestByID(testID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if utils.GetTestRight(&test, username) == utils.RIGHT_OWNER {
+		err = utils.DeleteTest(&test)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+
+	// collaborator leaves the test
+	for i := 0; i < len(test.Collaborators); i++ {
+		if test.Collaborators[i].Username == username {
+			test.Collaborators = append(test.Collaborators[:i], test.Collaborators[i+1:]...)
+			err = utils.SaveTestSettings(&test)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			break
+		}
+	}
 	err = utils.DeleteTestFromUsersList(username, testID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -146,3 +344,102 @@ func TestDeletionHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+// getOwnedTest loads the test from the url and checks that the teacher is its owner
+func getOwnedTest(w http.ResponseWriter, r *http.Request, prefix string) (*utils.Test, bool) {
+	if utils.CheckForValidStandardAccess(w, r) == false {
+		return nil, false
+	}
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	test, err := utils.GetTestByID(r.URL.Path[len(prefix):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	err = utils.CheckTestRight(&test, username, utils.RIGHT_OWNER)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return nil, false
+	}
+	return &test, true
+}
+
+func TestArchivingHandler(w http.ResponseWriter, r *http.Request) {
+	test, ok := getOwnedTest(w, r, "/test/archiveTest/process/")
+	if !ok {
+		return
+	}
+	test.Archived = !test.Archived
+	err := utils.SaveTestSettings(test)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/test/editTest/"+test.ID, http.StatusFound)
+}
+
+// TestSharingHandler changes rights of the collaborators and adds a new one
+func TestSharingHandler(w http.ResponseWriter, r *http.Request) {
+	test, ok := getOwnedTest(w, r, "/test/shareTest/process/")
+	if !ok {
+		return
+	}
+	collaborators := make([]utils.Collaborator, 0, len(test.Collaborators)+1)
+	removed := make([]string, 0)
+	for i, c := range test.Collaborators {
+		if r.FormValue(fmt.Sprintf("remove%d", i)) == "on" {
+			removed = append(removed, c.Username)
+			continue
+		}
+		right := r.FormValue(fmt.Sprintf("right%d", i))
+		if utils.IsValidCollaboratorRight(right) {
+			c.Right = right
+		}
+		collaborators = append(collaborators, c)
+	}
+	newCollaborator := strings.TrimSpace(r.FormValue("newCollaborator"))
+	if newCollaborator != "" {
+		user, err := utils.GetAccauntInfo(newCollaborator)
+		if err != nil || !user.Teacher {
+			http.Error(w, fmt.Sprintf("Teacher %s does not exist", newCollaborator), http.StatusBadRequest)
+			return
+		}
+		right := r.FormValue("newRight")
+		if !utils.IsValidCollaboratorRight(right) {
+			right = utils.RIGHT_VIEW
+		}
+		if newCollaborator == test.Owner {
+			http.Error(w, "Owner can't be a collaborator", http.StatusBadRequest)
+			return
+		}
+		for _, c := range collaborators {
+			if c.Username == newCollaborator {
+				http.Error(w, fmt.Sprintf("%s is already a collaborator", newCollaborator), http.StatusBadRequest)
+				return
+			}
+		}
+		collaborators = append(collaborators, utils.Collaborator{Username: newCollaborator, Right: right})
+		err = utils.AddTestToUsersList(newCollaborator, test.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, username := range removed {
+		err := utils.DeleteTestFromUsersList(username, test.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	test.Collaborators = collaborators
+	err := utils.SaveTestSettings(test)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/test/editTest/"+test.ID, http.StatusFound)
+}
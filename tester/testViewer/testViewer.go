@@ -3,9 +3,8 @@ package testViewer
 import (
 	"net/http"
 	"tucklejudge/utils"
+	"tucklejudge/utils/formLayout"
 	"strings"
-	"strconv"
-	"fmt"
 )
 
 func TestViewHandler(w http.ResponseWriter, r *http.Request) {
@@ -19,43 +18,33 @@ func TestViewHandler(w http.ResponseWriter, r *http.Request) {
 	utils.UserFilesMutex.Lock()
 	username, _ := utils.LoginCookieStorage.ReturnNodeValue(c.Value)
 	utils.UserFilesMutex.Unlock()
+	// teachers need the view right for the test to see results of the students
+	reviewer := false
 	if username != givenUsername {
-		user, err := utils.GetAccauntInfo(username)
+		test, err := utils.GetTestByID(givenTestID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if !user.Teacher {
+		if !utils.HasTestRight(&test, username, utils.RIGHT_VIEW) {
 			http.Redirect(w, r, "/", http.StatusFound)
 			return
 		}
+		reviewer = utils.HasTestRight(&test, username, utils.RIGHT_CHECK)
 	}
 	// receiving test from system files
-	str, err := utils.GetTestUsersResultByID(givenTestID, givenUsername)
+	testInfo, err := utils.GetTestUsersResultByID(givenTestID, givenUsername)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	strs := strings.Split(str, "\n")
-	testInfo := &utils.PersonalTest{
-		UserName: givenUsername,
-		TestName: strs[0][len("TestName: "):],
-		Mark: strs[1][len("Mark: "):],
-		InputImageName: strs[2][len("Input image name: "):],
-		ProcessedImageName: strs[3][len("Processed image name: "):],
-		//Questions: []PersonalQuestion
-		PointsSum: strs[len(strs)-6][len("Points sum: "):],
-		PointsToMark: [3]string{strs[len(strs)-4], strs[len(strs)-3], strs[len(strs)-2]},
-	}
-	n, _ := strconv.Atoi(strs[4][len("Questions ("):len(strs[4])-1])
-	testInfo.Questions = make([]utils.PersonalQuestion, n)
-	for i := 0; i < n; i++ {
-		s := strings.Split(strs[5+i][len(fmt.Sprintf("%d) ", i+1)):], " ")
-		testInfo.Questions[i].Index = fmt.Sprint(i+1)
-		testInfo.Questions[i].UserAnswer = s[0]
-		testInfo.Questions[i].CorrectAnswer = s[1]
-		testInfo.Questions[i].Points = s[2]
+	// the mark of a result waiting for review isn't shown to the student
+	testInfo.UnderReviewForTemplate = username == givenUsername && len(testInfo.Review) > 0
+	testInfo.ReviewerForTemplate = reviewer
+	if reviewer {
+		testInfo.DebugBundleForTemplate = utils.VisibleDebugBundle(testInfo.InputImageName, username)
 	}
+	testInfo.TestIDForTemplate = givenTestID
 	utils.RenderTemplate(w, "testViewer", testInfo)
 }
 
@@ -64,11 +53,39 @@ func TeacherTestViewHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	filename := r.URL.Path[len("/test/teacherView/"):]
+	username, err := utils.GetUsername(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// checks are visible only to the teacher who made them
+	user, err := utils.GetAccauntInfo(username)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	found := false
+	for _, id := range user.Tests {
+		found = found || id == filename
+	}
+	if !found {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
 	testingInfo, err := utils.LoadShortResultsFromFile(filename)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	testingInfo.Summarize()
+	for i := range testingInfo.Failures {
+		testingInfo.Failures[i].DebugBundleForTemplate = utils.VisibleDebugBundle(testingInfo.Failures[i].ImageName, username)
+	}
+	testingInfo.LayoutsForTemplate, err = formLayout.GetLayouts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	utils.RenderTemplate(w, "testChecker", testingInfo)
 }
 
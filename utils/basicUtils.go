@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"html/template"
 	"tucklejudge/utils/splayMap"
+	"tucklejudge/utils/formLayout"
 	"sync"
 	"math/rand"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sort"
 	"io"
 	"errors"
 	"image"
@@ -27,9 +29,11 @@ var IDtoUsername = &splayMap.SplayTree[int, string]{}
 var LoginCookieStorage = &splayMap.SplayTree[string, string]{}
 var VerificationCode string // length = 6
 
-var templates = template.Must(template.ParseGlob("templates/*.html"))
+// templates are parsed by Init, so the packages using utils don't need them to be in the working directory
+var templates *template.Template
 
 func Init() {
+	templates = template.Must(template.ParseGlob("templates/*.html"))
 	// initializing IDs to Users (using users.txt)
 	f, err := os.Open("authentication/users.txt")
 	if err != nil {
@@ -287,9 +291,42 @@ func GetAccauntInfo(username string) (*User, error) {
 	return user, scanner.Err()
 }
 
+// GetClassStudents returns students of the class ordered by surname and name
+func GetClassStudents(grade, letter string) ([]User, error) {
+	b, err := os.ReadFile("authentication/users.txt")
+	if err != nil {
+		return nil, err
+	}
+	students := make([]User, 0)
+	for _, username := range strings.Fields(string(b)) {
+		user, err := GetAccauntInfo(username)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !user.Teacher && user.Grade == grade && user.Letter == letter {
+			students = append(students, *user)
+		}
+	}
+	sort.Slice(students, func(i, j int) bool {
+		if students[i].Surname != students[j].Surname {
+			return students[i].Surname < students[j].Surname
+		}
+		return students[i].Name < students[j].Name
+	})
+	return students, nil
+}
+
 type Question struct {
-	Answer string
+	Answer string // answer of the variant being checked
+	Answers []string // answers of all test variants
 	Points int
+	Credit string // one of CreditPolicies
+	Penalty int // points taken for a wrong answer
+	Section string // total of a section can't be negative
+	BankID string // question of the bank the question was taken from
 	IndexForTemplate int
 }
 
@@ -297,8 +334,67 @@ type Test struct {
 	ID string
 	Name string
 	Questions []Question
-	PointsToMark [3]int // < 2, 3, 4
+	Scale GradingScale
+	Version int // every saving of the test creates a new version of the key
+	Owner string // tests created before ownership have no owner
+	Collaborators []Collaborator
+	Archived bool // archived tests can't be checked or edited
 	NumberOfQuestionsForTemplate int
+	NumberOfVariantsForTemplate int
+	VariantsForTemplate []int
+	ScalesForTemplate []GradingScale
+	LayoutsForTemplate []*formLayout.Layout
+	ChangeLogForTemplate []string
+	RightForTemplate string
+	CollaboratorRightsForTemplate []string
+}
+
+const MAX_VARIANTS = 4
+
+// MaxPoints is the sum of points for all questions
+func (test *Test) MaxPoints() int {
+	sum := 0
+	for _, q := range test.Questions {
+		sum += q.Points
+	}
+	return sum
+}
+
+func (test *Test) NumberOfVariants() int {
+	variants := 1
+	for _, q := range test.Questions {
+		if len(q.Answers) > variants {
+			variants = len(q.Answers)
+		}
+	}
+	return variants
+}
+
+// ParseVariant reads the variant written in the variant field, the blank cells around it don't matter.
+// A test with one variant has no need of the field, so any value of it is variant 1
+func (test *Test) ParseVariant(value string) (int, error) {
+	if test.NumberOfVariants() == 1 {
+		return 1, nil
+	}
+	variant, err := strconv.Atoi(strings.Trim(value, formLayout.BLANK_CELL))
+	if err != nil || variant < 1 || variant > test.NumberOfVariants() {
+		return 0, errors.New(fmt.Sprintf("Test %s has no variant %s", test.ID, formLayout.ShowBlanks(value)))
+	}
+	return variant, nil
+}
+
+// KeyForVariant returns questions with answers of the particular variant (variants are numbered from 1)
+func (test *Test) KeyForVariant(variant int) []Question {
+	key := make([]Question, len(test.Questions))
+	for i, q := range test.Questions {
+		key[i] = q
+		if variant >= 1 && variant <= len(q.Answers) {
+			key[i].Answer = q.Answers[variant-1]
+		} else if len(q.Answers) > 0 {
+			key[i].Answer = q.Answers[0]
+		}
+	}
+	return key
 }
 
 var TestFilesMutex sync.Mutex
@@ -332,17 +428,26 @@ func (test *Test) CreateIDAndSave() error {
 	// os.WriteFile("tester/currentID.txt", []byte(fmt.Sprintf("%d", id+1)), 0600)
 
 	// creating new test file
+	test.Version = 1
 	return SaveTestToFile(test)
 }
 
 func SaveTestToFile(test *Test) error {
 	testInfo := fmt.Sprintf("Name: %s\nQuestions (%d)\n", test.Name, len(test.Questions))
 	for i, q := range test.Questions {
-		testInfo += fmt.Sprintf("Question %d.\n%s\n%d\n", i, q.Answer, q.Points)
+		testInfo += fmt.Sprintf("Question %d.\n%s\n%d %s %d %s", i, strings.Join(q.Answers, "|"), q.Points, q.Credit, q.Penalty, q.Section)
+		if q.BankID != "" {
+			testInfo += " #" + q.BankID
+		}
+		testInfo += "\n"
 	}
-	testInfo += "Points to mark: 2, 3, 4\n"
-	for _, q := range test.PointsToMark {
-		testInfo += fmt.Sprintf("%d\n", q)
+	testInfo += writeGradingScale(&test.Scale)
+	testInfo += fmt.Sprintf("Version: %d\n", test.Version)
+	testInfo += fmt.Sprintf("Owner: %s\n", test.Owner)
+	testInfo += fmt.Sprintf("Archived: %v\n", test.Archived)
+	testInfo += fmt.Sprintf("Collaborators (%d)\n", len(test.Collaborators))
+	for _, c := range test.Collaborators {
+		testInfo += fmt.Sprintf("%s %s\n", c.Username, c.Right)
 	}
 
 	return os.WriteFile(fmt.Sprintf("tester/tests/%s.txt", test.ID), []byte(testInfo), 0600)
@@ -359,6 +464,7 @@ func GetTestByID(id string) (Test, error) {
 	if err != nil {
 		return test, err
 	}
+	defer f.Close()
 	scanner := bufio.NewScanner(f)
 	scanner.Scan()
 	test.Name = scanner.Text()[len("Name: "):]
@@ -372,20 +478,82 @@ func GetTestByID(id string) (Test, error) {
 		q := &test.Questions[i]
 		scanner.Scan()
 		scanner.Scan()
-		q.Answer = scanner.Text()
+		// answers of the variants are separated by '|'
+		q.Answers = strings.Split(scanner.Text(), "|")
+		q.Answer = q.Answers[0]
 		scanner.Scan()
-		q.Points, err = strconv.Atoi(scanner.Text())
+		// points line is "points credit penalty section #bankID", older tests have only points
+		pointsInfo := make([]string, 0)
+		for _, field := range strings.Fields(scanner.Text()) {
+			if strings.HasPrefix(field, "#") {
+				q.BankID = field[1:]
+			} else {
+				pointsInfo = append(pointsInfo, field)
+			}
+		}
+		if len(pointsInfo) == 0 {
+			return test, errors.New(fmt.Sprintf("Test %s has no points for question %d", id, i+1))
+		}
+		q.Points, err = strconv.Atoi(pointsInfo[0])
 		if err != nil {
 			return test, err
 		}
+		q.Credit = CREDIT_ALL
+		if len(pointsInfo) > 1 && IsValidCredit(pointsInfo[1]) {
+			q.Credit = pointsInfo[1]
+		}
+		if len(pointsInfo) > 2 {
+			q.Penalty, _ = strconv.Atoi(pointsInfo[2])
+		}
+		if len(pointsInfo) > 3 {
+			q.Section = pointsInfo[3]
+		}
 	}
-	scanner.Scan() // scanning "Points to mark: 2, 3, 4"
-	for i, _ := range test.PointsToMark {
-		scanner.Scan()
-		test.PointsToMark[i], _ = strconv.Atoi(scanner.Text())
+	scanner.Scan()
+	if strings.HasPrefix(scanner.Text(), "Scale: ") {
+		test.Scale, err = readGradingScale(scanner)
+		if err != nil {
+			return test, err
+		}
+	} else {
+		// "Points to mark: 2, 3, 4" of tests created before grading scales were introduced
+		var pointsToMark [3]int
+		for i, _ := range pointsToMark {
+			scanner.Scan()
+			pointsToMark[i], _ = strconv.Atoi(scanner.Text())
+		}
+		test.Scale = LegacyGradingScale(pointsToMark)
+	}
+	// tests created before versioning are considered to be the first version
+	test.Version = 1
+	if scanner.Scan() && strings.HasPrefix(scanner.Text(), "Version: ") {
+		test.Version, err = strconv.Atoi(scanner.Text()[len("Version: "):])
+		if err != nil {
+			return test, err
+		}
 	}
+	// tests created before ownership have no owner and collaborators
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), "Owner: ") {
+		return test, nil
+	}
+	test.Owner = scanner.Text()[len("Owner: "):]
+	scanner.Scan()
+	test.Archived = scanner.Text()[len("Archived: "):] == "true"
 	scanner.Scan()
-	return test, nil
+	n, err = strconv.Atoi(scanner.Text()[len("Collaborators ("):len(scanner.Text())-1])
+	if err != nil {
+		return test, err
+	}
+	test.Collaborators = make([]Collaborator, n)
+	for i := range test.Collaborators {
+		scanner.Scan()
+		s := strings.Fields(scanner.Text())
+		if len(s) != 2 {
+			return test, errors.New(fmt.Sprintf("Test %s has corrupted collaborator %d", id, i+1))
+		}
+		test.Collaborators[i] = Collaborator{Username: s[0], Right: s[1]}
+	}
+	return test, scanner.Err()
 }
 
 func CheckForTeacher(r *http.Request) bool {
@@ -441,12 +609,115 @@ func DeleteTestFromUsersList(username string, testID string) error {
 	return user.Save()
 }
 
-func GetTestUsersResultByID(testID string, username string) (string, error) {
+func GetTestUsersResultByID(testID string, username string) (*PersonalTest, error) {
 	b, err := os.ReadFile(fmt.Sprintf("tester/testResults/%s$%s.txt", testID, username))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	strs := strings.Split(string(b), "\n")
+	if len(strs) < 10 {
+		return nil, errors.New(fmt.Sprintf("Result of %s for test %s is corrupted", username, testID))
+	}
+	results := &PersonalTest{
+		UserName: username,
+		TestName: strs[0][len("TestName: "):],
+		Mark: strs[1][len("Mark: "):],
+		InputImageName: strs[2][len("Input image name: "):],
+		ProcessedImageName: strs[3][len("Processed image name: "):],
+		Variant: "1",
+	}
+	line := 4
+	if strings.HasPrefix(strs[line], "Variant: ") {
+		results.Variant = strs[line][len("Variant: "):]
+		line++
+	}
+	if strings.HasPrefix(strs[line], "Key version: ") {
+		results.KeyVersion = strs[line][len("Key version: "):]
+		line++
+	}
+	if strings.HasPrefix(strs[line], "Recognized answers: ") {
+		results.RecognizedAnswers = strings.Split(strs[line][len("Recognized answers: "):], "|")
+		line++
+	}
+	if strings.HasPrefix(strs[line], "Normalized image name: ") {
+		results.NormalizedImageName = strs[line][len("Normalized image name: "):]
+		line++
+	}
+	if strings.HasPrefix(strs[line], "Needs review: ") {
+		results.Review = strings.Split(strs[line][len("Needs review: "):], "|")
+		line++
 	}
-	return string(b), nil
+	if strings.HasPrefix(strs[line], "Recognized fields (") {
+		n, err := strconv.Atoi(strs[line][len("Recognized fields ("):len(strs[line])-1])
+		if err != nil {
+			return nil, err
+		}
+		line++
+		if len(strs) < line+n {
+			return nil, errors.New(fmt.Sprintf("Result of %s for test %s is corrupted", username, testID))
+		}
+		results.Fields = make([]RecognizedField, n)
+		for i := range results.Fields {
+			err = results.Fields[i].parse(strs[line])
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Result of %s for test %s is corrupted: %s", username, testID, err.Error()))
+			}
+			line++
+		}
+	}
+	n, err := strconv.Atoi(strs[line][len("Questions ("):len(strs[line])-1])
+	if err != nil {
+		return nil, err
+	}
+	line++
+	if len(strs) < line+n+5 {
+		return nil, errors.New(fmt.Sprintf("Result of %s for test %s is corrupted", username, testID))
+	}
+	results.Questions = make([]PersonalQuestion, n)
+	for i := range results.Questions {
+		q := &results.Questions[i]
+		s := strings.Split(strs[line][len(fmt.Sprintf("%d) ", i+1)):], " ")
+		line++
+		q.Index = fmt.Sprint(i+1)
+		q.UserAnswer = s[0]
+		q.CorrectAnswer = s[1]
+		q.Points = s[2]
+		// results checked before scoring policies were introduced are all-or-nothing
+		q.Credit = CREDIT_ALL
+		q.Penalty = "0"
+		if len(s) > 4 {
+			q.Credit = s[3]
+			q.Penalty = s[4]
+		}
+		if len(s) > 5 {
+			q.Section = s[5]
+		}
+	}
+	results.PointsSum = strs[line][len("Points sum: "):]
+	line++
+	if strings.HasPrefix(strs[line], "Mark bounds (") {
+		n, err = strconv.Atoi(strs[line][len("Mark bounds ("):len(strs[line])-1])
+		if err != nil {
+			return nil, err
+		}
+		line++
+		if len(strs) < line+n {
+			return nil, errors.New(fmt.Sprintf("Result of %s for test %s is corrupted", username, testID))
+		}
+		results.MarkBounds = make([]MarkBound, n)
+		for i := range results.MarkBounds {
+			bound := strings.Split(strs[line+i], " ")
+			results.MarkBounds[i].Mark = bound[0]
+			results.MarkBounds[i].Points = bound[len(bound)-1]
+		}
+	} else {
+		// "Points to mark: 2, 3, 4" of results checked before grading scales were introduced
+		results.MarkBounds = []MarkBound{MarkBound{Mark: "2", Points: "0"}}
+		for i := 0; i < 3; i++ {
+			results.MarkBounds = append(results.MarkBounds, MarkBound{Mark: fmt.Sprint(i+3), Points: strs[line+1+i]})
+		}
+	}
+	return results, nil
 }
 
 type PersonalQuestion struct {
@@ -454,6 +725,13 @@ type PersonalQuestion struct {
 	UserAnswer string
 	CorrectAnswer string
 	Points string
+	Credit string
+	Penalty string
+	Section string
+}
+
+func (q *PersonalQuestion) UserAnswerForTemplate() string {
+	return formLayout.ShowBlanks(q.UserAnswer)
 }
 
 type PersonalTest struct {
@@ -462,9 +740,19 @@ type PersonalTest struct {
 	Mark string
 	InputImageName string
 	ProcessedImageName string
+	Variant string
+	KeyVersion string
+	RecognizedAnswers []string // full recognized answers, they are needed for regrading
+	NormalizedImageName string // the sheet as it was read
+	Fields []RecognizedField // fields as they were recognized and corrected by the teacher
+	Review []string // fields read with low confidence, the mark is hidden from the student until the teacher reviews them
 	Questions []PersonalQuestion
 	PointsSum string
-	PointsToMark [3]string
+	MarkBounds []MarkBound
+	TestIDForTemplate string
+	UnderReviewForTemplate bool // the student waits for the review
+	ReviewerForTemplate bool // the teacher can correct and approve the result
+	DebugBundleForTemplate string
 }
 
 func CreateTestResultFile(personalTestName string, results *PersonalTest) error {
@@ -474,33 +762,167 @@ func CreateTestResultFile(personalTestName string, results *PersonalTest) error
 	out += fmt.Sprintf("Mark: %s\n", results.Mark)
 	out += fmt.Sprintf("Input image name: %s\n", results.InputImageName)
 	out += fmt.Sprintf("Processed image name: %s\n", results.ProcessedImageName)
+	out += fmt.Sprintf("Variant: %s\n", results.Variant)
+	out += fmt.Sprintf("Key version: %s\n", results.KeyVersion)
+	out += fmt.Sprintf("Recognized answers: %s\n", strings.Join(results.RecognizedAnswers, "|"))
+	if results.NormalizedImageName != "" {
+		out += fmt.Sprintf("Normalized image name: %s\n", results.NormalizedImageName)
+	}
+	if len(results.Review) > 0 {
+		out += fmt.Sprintf("Needs review: %s\n", strings.Join(results.Review, "|"))
+	}
+	if len(results.Fields) > 0 {
+		out += fmt.Sprintf("Recognized fields (%d)\n", len(results.Fields))
+		for _, field := range results.Fields {
+			out += field.String() + "\n"
+		}
+	}
 	out += fmt.Sprintf("Questions (%d)\n", len(results.Questions))
 
 	for _, q := range results.Questions {
-		out += fmt.Sprintf("%s) %s %s %s\n", q.Index, q.UserAnswer, q.CorrectAnswer, q.Points)
+		out += fmt.Sprintf("%s) %s %s %s %s %s %s\n", q.Index, q.UserAnswer, q.CorrectAnswer, q.Points, q.Credit, q.Penalty, q.Section)
 	}
 
 	out += fmt.Sprintf("Points sum: %s\n", results.PointsSum)
-	out += "Points to mark: 2, 3, 4\n"
-	out += fmt.Sprintf("%s\n%s\n%s\n", results.PointsToMark[0], results.PointsToMark[1], results.PointsToMark[2])
+	out += fmt.Sprintf("Mark bounds (%d)\n", len(results.MarkBounds))
+	for _, bound := range results.MarkBounds {
+		out += fmt.Sprintf("%s %s\n", bound.Mark, bound.Points)
+	}
 
 	return os.WriteFile(filePath, []byte(out), 0600)
 }
 
 type PersonalResult struct {
-	TestID, Username, FullName, Mark string
+	TestID, Username, FullName, Mark, Variant string
+	NeedsReview bool
 	IndexForTemplate int
 }
 
+type TestSummary struct {
+	TestID string
+	TestName string
+	Sheets int
+	SheetsByVariant string
+	AverageMark string
+}
+
+// PageFailure is a page of a check that wasn't graded
+type PageFailure struct {
+	Page int
+	ImageName string // the page as it was uploaded, empty when it couldn't be read at all
+	Reason string
+	DebugBundleForTemplate string
+}
+
 type ShortTestResultsInfo struct {
 	Results []PersonalResult
+	Failures []PageFailure
+	Tests []TestSummary // all variants of a test are summarized together
 	IDForTemplate string
+	LayoutsForTemplate []*formLayout.Layout
+}
+
+// Summarize aggregates results by tests regardless of variants
+func (results *ShortTestResultsInfo) Summarize() {
+	results.Tests = make([]TestSummary, 0)
+	testIndex := make(map[string]int)
+	variants := make([]map[string]int, 0)
+	marksSum := make([]float64, 0)
+	numericMarks := make([]int, 0) // letter marks aren't averaged
+	for _, r := range results.Results {
+		ind, ok := testIndex[r.TestID]
+		if !ok {
+			ind = len(results.Tests)
+			testIndex[r.TestID] = ind
+			results.Tests = append(results.Tests, TestSummary{TestID: r.TestID, TestName: r.TestID})
+			if test, err := GetTestByID(r.TestID); err == nil {
+				results.Tests[ind].TestName = test.Name
+			}
+			variants = append(variants, make(map[string]int))
+			marksSum = append(marksSum, 0)
+			numericMarks = append(numericMarks, 0)
+		}
+		results.Tests[ind].Sheets++
+		variants[ind][r.Variant]++
+		if mark, err := strconv.Atoi(r.Mark); err == nil {
+			marksSum[ind] += float64(mark)
+			numericMarks[ind]++
+		}
+	}
+	for i := range results.Tests {
+		t := &results.Tests[i]
+		for v := 1; v <= MAX_VARIANTS; v++ {
+			if cnt, ok := variants[i][fmt.Sprint(v)]; ok {
+				if t.SheetsByVariant != "" {
+					t.SheetsByVariant += ", "
+				}
+				t.SheetsByVariant += fmt.Sprintf("variant %d: %d", v, cnt)
+			}
+		}
+		t.AverageMark = "-"
+		if numericMarks[i] > 0 {
+			t.AverageMark = fmt.Sprintf("%.2f", marksSum[i]/float64(numericMarks[i]))
+		}
+	}
+}
+
+// String is the line of the result in the files of checks
+func (r *PersonalResult) String() string {
+	out := fmt.Sprintf("%s %s %s %s %s", r.TestID, r.Username, r.FullName, r.Mark, r.Variant)
+	if r.NeedsReview {
+		out += " review"
+	}
+	return out
+}
+
+func parsePersonalResult(line string) PersonalResult {
+	cur_line := strings.Split(line, " ")
+	result := PersonalResult{
+		TestID: cur_line[0],
+		Username: cur_line[1],
+		FullName: cur_line[2] + " " + cur_line[3],
+		Mark: cur_line[4],
+		Variant: "1",
+	}
+	if len(cur_line) > 5 {
+		result.Variant = cur_line[5]
+	}
+	result.NeedsReview = len(cur_line) > 6 && cur_line[6] == "review"
+	return result
+}
+
+func (f *PageFailure) String() string {
+	imageName := f.ImageName
+	if imageName == "" {
+		imageName = "-"
+	}
+	return fmt.Sprintf("%d %s %s", f.Page, imageName, strings.ReplaceAll(f.Reason, "\n", " "))
+}
+
+func parsePageFailure(line string) (PageFailure, error) {
+	cur_line := strings.SplitN(line, " ", 3)
+	if len(cur_line) != 3 {
+		return PageFailure{}, errors.New(fmt.Sprintf("Failed page %s is broken", line))
+	}
+	page, err := strconv.Atoi(cur_line[0])
+	if err != nil {
+		return PageFailure{}, err
+	}
+	failure := PageFailure{Page: page, Reason: cur_line[2]}
+	if cur_line[1] != "-" {
+		failure.ImageName = cur_line[1]
+	}
+	return failure, nil
 }
 
 func SaveShortResultsInfoToFile(filename string, results *ShortTestResultsInfo) error {
 	out := fmt.Sprintf("Results (%d)\n", len(results.Results))
 	for _, r := range results.Results {
-		out += fmt.Sprintf("%s %s %s %s\n", r.TestID, r.Username, r.FullName, r.Mark)
+		out += r.String() + "\n"
+	}
+	out += fmt.Sprintf("Failed pages (%d)\n", len(results.Failures))
+	for _, f := range results.Failures {
+		out += f.String() + "\n"
 	}
 	return os.WriteFile(fmt.Sprintf("tester/teacherTestResults/%s.txt", filename), []byte(out), 0600)
 }
@@ -517,13 +939,24 @@ func LoadShortResultsFromFile(filename string) (*ShortTestResultsInfo, error) {
 		IDForTemplate: filename,
 	}
 	for i := range results.Results {
-		cur_line := strings.Split(in[i+1], " ")
-		results.Results[i].TestID = cur_line[0]
-		results.Results[i].Username = cur_line[1]
-		results.Results[i].FullName = cur_line[2] + " " + cur_line[3]
-		results.Results[i].Mark = cur_line[4]
+		results.Results[i] = parsePersonalResult(in[i+1])
 		results.Results[i].IndexForTemplate = i+1
 	}
+	// checks saved before failed pages were recorded end here
+	line := n+1
+	if line < len(in) && strings.HasPrefix(in[line], "Failed pages (") {
+		m, err := strconv.Atoi(in[line][len("Failed pages ("):len(in[line])-1])
+		if err != nil {
+			return nil, err
+		}
+		results.Failures = make([]PageFailure, m)
+		for i := range results.Failures {
+			results.Failures[i], err = parsePageFailure(in[line+1+i])
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed page %d of check %s is broken", i+1, filename))
+			}
+		}
+	}
 	return results, nil
 }
 
@@ -557,6 +990,18 @@ func ClearAllData(w http.ResponseWriter, r *http.Request) {
 	Must(os.RemoveAll("tester/teacherTestResults"))
 	Must(os.Mkdir("tester/teacherTestResults", 0755))
 	Must(os.WriteFile("tester/teacherTestResults/currentID.txt", []byte("0"), 0600))
+	// clear all check jobs and set currentID to zero, so unfinished jobs don't resume into the checks of the new IDs
+	CheckJobsMutex.Lock()
+	Must(os.RemoveAll(CHECK_JOBS_FOLDER))
+	Must(os.Mkdir(CHECK_JOBS_FOLDER, 0755))
+	Must(os.WriteFile(CHECK_JOBS_FOLDER+"/currentID.txt", []byte("0"), 0600))
+	CheckJobsMutex.Unlock()
+	// clear all debug bundles, they're recreated with the first one
+	Must(os.RemoveAll(DEBUG_BUNDLES_FOLDER))
+	// clear all versions of tests
+	Must(os.RemoveAll("tester/testVersions"))
+	// clear the question bank, it's recreated with the first question
+	Must(os.RemoveAll(QUESTION_BANK_FOLDER))
 	// clear all testResults
 	Must(os.RemoveAll("tester/testResults"))
 	Must(os.Mkdir("tester/testResults", 0755))
@@ -582,5 +1027,6 @@ func SaveImageToSrc(img image.Image) string {
 	}
 	f, _ := os.Create(filepath)
 	_ = png.Encode(f, img)
+	f.Close()
 	return fileName
 }
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const CHECK_JOBS_FOLDER = "tester/checkJobs"
+
+// statuses of check jobs and of their pages
+const JOB_QUEUED = "queued"
+const JOB_RUNNING = "running"
+const JOB_DONE = "done"
+const JOB_FAILED = "failed"
+
+var CheckJobsMutex sync.Mutex
+
+// JobPage is the state of one page of a check job, Result is set for graded pages and Failure for the failed ones
+type JobPage struct {
+	Status string
+	Result *PersonalResult
+	Failure *PageFailure
+	IndexForTemplate int
+}
+
+// CheckJob is a check of an uploaded file made in the background, its file is saved after every page,
+// so the job goes on from the first unfinished page after a restart
+type CheckJob struct {
+	ID string
+	Teacher string
+	CheckID string // results are saved to the check like the ones of a synchronous check
+	FileName string // uploaded file in src
+	Layout string // empty when the layout is chosen by the squares
+	Threshold float64
+	Status string
+	Error string // why the whole job failed
+	Debug bool // debug bundles are saved for the pages
+	Pages []JobPage // empty until the file is opened
+	DonePagesForTemplate int
+}
+
+func (job *CheckJob) Finished() bool {
+	return job.Status == JOB_DONE || job.Status == JOB_FAILED
+}
+
+// ShortResults are the results of the pages checked so far in the order of the pages
+func (job *CheckJob) ShortResults() *ShortTestResultsInfo {
+	results := &ShortTestResultsInfo{
+		Results: make([]PersonalResult, 0),
+		Failures: make([]PageFailure, 0),
+		IDForTemplate: job.CheckID,
+	}
+	for _, page := range job.Pages {
+		if page.Result != nil {
+			results.Results = append(results.Results, *page.Result)
+		}
+		if page.Failure != nil {
+			results.Failures = append(results.Failures, *page.Failure)
+		}
+	}
+	return results
+}
+
+// SaveCheckJob writes the job to tester/checkJobs/<ID>.txt
+func SaveCheckJob(job *CheckJob) error {
+	var out string
+	out += fmt.Sprintf("Teacher: %s\n", job.Teacher)
+	out += fmt.Sprintf("Check ID: %s\n", job.CheckID)
+	out += fmt.Sprintf("File name: %s\n", job.FileName)
+	out += fmt.Sprintf("Layout: %s\n", dashIfEmpty(job.Layout))
+	out += fmt.Sprintf("Threshold: %.2f\n", job.Threshold)
+	out += fmt.Sprintf("Status: %s\n", job.Status)
+	out += fmt.Sprintf("Error: %s\n", dashIfEmpty(strings.ReplaceAll(job.Error, "\n", " ")))
+	out += fmt.Sprintf("Debug bundles: %t\n", job.Debug)
+	out += fmt.Sprintf("Pages (%d)\n", len(job.Pages))
+	for _, page := range job.Pages {
+		out += page.Status
+		if page.Result != nil {
+			out += " " + page.Result.String()
+		} else if page.Failure != nil {
+			out += " " + page.Failure.String()
+		}
+		out += "\n"
+	}
+	CheckJobsMutex.Lock()
+	defer CheckJobsMutex.Unlock()
+	return os.WriteFile(fmt.Sprintf("%s/%s.txt", CHECK_JOBS_FOLDER, job.ID), []byte(out), 0600)
+}
+
+func GetCheckJob(id string) (*CheckJob, error) {
+	CheckJobsMutex.Lock()
+	b, err := os.ReadFile(fmt.Sprintf("%s/%s.txt", CHECK_JOBS_FOLDER, id))
+	CheckJobsMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	strs := strings.Split(string(b), "\n")
+	if len(strs) < 8 {
+		return nil, errors.New(fmt.Sprintf("Check job %s is corrupted", id))
+	}
+	job := &CheckJob{
+		ID: id,
+		Teacher: strs[0][len("Teacher: "):],
+		CheckID: strs[1][len("Check ID: "):],
+		FileName: strs[2][len("File name: "):],
+		Layout: emptyIfDash(strs[3][len("Layout: "):]),
+		Status: strs[5][len("Status: "):],
+		Error: emptyIfDash(strs[6][len("Error: "):]),
+	}
+	job.Threshold, err = strconv.ParseFloat(strs[4][len("Threshold: "):], 64)
+	if err != nil {
+		return nil, err
+	}
+	// jobs saved before debug bundles have no line for them
+	line := 7
+	if strings.HasPrefix(strs[line], "Debug bundles: ") {
+		job.Debug, err = strconv.ParseBool(strs[line][len("Debug bundles: "):])
+		if err != nil {
+			return nil, err
+		}
+		line++
+	}
+	if len(strs) <= line || !strings.HasPrefix(strs[line], "Pages (") {
+		return nil, errors.New(fmt.Sprintf("Check job %s is corrupted", id))
+	}
+	n, err := strconv.Atoi(strs[line][len("Pages ("):len(strs[line])-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(strs) < line+1+n {
+		return nil, errors.New(fmt.Sprintf("Check job %s is corrupted", id))
+	}
+	job.Pages = make([]JobPage, n)
+	for i := range job.Pages {
+		s := strings.SplitN(strs[line+1+i], " ", 2)
+		page := &job.Pages[i]
+		page.Status = s[0]
+		page.IndexForTemplate = i+1
+		if page.Status == JOB_DONE || page.Status == JOB_FAILED {
+			job.DonePagesForTemplate++
+		}
+		if len(s) < 2 {
+			continue
+		}
+		switch page.Status {
+		case JOB_DONE:
+			result := parsePersonalResult(s[1])
+			page.Result = &result
+		case JOB_FAILED:
+			failure, err := parsePageFailure(s[1])
+			if err != nil {
+				return nil, err
+			}
+			page.Failure = &failure
+		}
+	}
+	return job, nil
+}
+
+// GetUnfinishedCheckJobs returns IDs of the jobs which were queued or running in the order they were created
+func GetUnfinishedCheckJobs() ([]string, error) {
+	entries, err := os.ReadDir(CHECK_JOBS_FOLDER)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for _, entry := range entries {
+		if entry.Name() == "currentID.txt" || !strings.HasSuffix(entry.Name(), ".txt") {
+			continue
+		}
+		id := entry.Name()[:len(entry.Name())-len(".txt")]
+		job, err := GetCheckJob(id)
+		if err != nil {
+			return nil, err
+		}
+		if !job.Finished() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GetUnfinishedJobOfCheck returns ID of the queued or running job of the check, it's empty when there is no such job
+func GetUnfinishedJobOfCheck(checkID string) (string, error) {
+	ids, err := GetUnfinishedCheckJobs()
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		job, err := GetCheckJob(id)
+		if err != nil {
+			return "", err
+		}
+		if job.CheckID == checkID {
+			return id, nil
+		}
+	}
+	return "", nil
+}
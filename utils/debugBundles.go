@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const DEBUG_BUNDLES_FOLDER = "tester/debugBundles"
+
+// DebugSquare is the bounding box of a fiducial square found on the page
+type DebugSquare struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// DebugGuess is a digit suggested by a classifier, 10 means an empty cell
+type DebugGuess struct {
+	Digit int `json:"digit"`
+	Score float64 `json:"score,omitempty"` // only the network gives probabilities
+}
+
+func (guess DebugGuess) String() string {
+	digit := "empty"
+	if guess.Digit != 10 {
+		digit = fmt.Sprint(guess.Digit)
+	}
+	if guess.Score == 0 {
+		return digit
+	}
+	return fmt.Sprintf("%s (%.2f)", digit, guess.Score)
+}
+
+type DebugPrediction struct {
+	Classifier string `json:"classifier"`
+	Top []DebugGuess `json:"top"` // the best guesses first
+}
+
+type DebugCell struct {
+	Field string `json:"field"`
+	Cell int `json:"cell"` // from 1, digits of a free-form field are numbered in the order of writing
+	CropImage string `json:"cropImage,omitempty"` // the 28x28 image given to the network, enlarged
+	Digit int `json:"digit"`
+	Void bool `json:"void,omitempty"` // crossed out or scribbled over
+	Confidence float64 `json:"confidence"`
+	Predictions []DebugPrediction `json:"predictions"`
+}
+
+func (cell *DebugCell) DigitForTemplate() string {
+	if cell.Void {
+		return "crossed out"
+	}
+	return DebugGuess{Digit: cell.Digit}.String()
+}
+
+// DebugBundle shows what every stage of recognition decided about a page, so a misread sheet can be understood
+// without recompiling with DEBUG, it's saved to tester/debugBundles/<ID>.json
+type DebugBundle struct {
+	ID string `json:"id"` // name of the input image without extension
+	Teacher string `json:"teacher"` // who checked the page, only they can see the bundle
+	InputImage string `json:"inputImage"`
+	SquaresImage string `json:"squaresImage,omitempty"` // the page the squares were looked for on, they're outlined
+	Squares []DebugSquare `json:"squares"`
+	Transform []string `json:"transform"` // steps of straightening the page in the order they're made
+	StraightenedImage string `json:"straightenedImage,omitempty"` // the marks the homography is fitted to are crossed on it
+	Layout string `json:"layout,omitempty"`
+	DocumentImage string `json:"documentImage,omitempty"` // the standardized document with the fields and cells outlined
+	Cells []DebugCell `json:"cells"`
+	Error string `json:"error,omitempty"`
+}
+
+// DebugBundleID is the ID of the bundle of the page uploaded as the image
+func DebugBundleID(inputImage string) string {
+	return strings.TrimSuffix(inputImage, ".png")
+}
+
+func SaveDebugBundle(bundle *DebugBundle) error {
+	err := os.MkdirAll(DEBUG_BUNDLES_FOLDER, 0700)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(bundle, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fmt.Sprintf("%s/%s.json", DEBUG_BUNDLES_FOLDER, bundle.ID), b, 0600)
+}
+
+func GetDebugBundle(id string) (*DebugBundle, error) {
+	if id == "" || strings.ContainsAny(id, "/\\.") {
+		return nil, os.ErrNotExist
+	}
+	b, err := os.ReadFile(fmt.Sprintf("%s/%s.json", DEBUG_BUNDLES_FOLDER, id))
+	if err != nil {
+		return nil, err
+	}
+	bundle := &DebugBundle{}
+	err = json.Unmarshal(b, bundle)
+	if err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// VisibleDebugBundle returns the ID of the bundle of the page when the user can see it, otherwise it's empty
+func VisibleDebugBundle(inputImage, username string) string {
+	if inputImage == "" {
+		return ""
+	}
+	bundle, err := GetDebugBundle(DebugBundleID(inputImage))
+	if err != nil || bundle.Teacher != username {
+		return ""
+	}
+	return bundle.ID
+}
@@ -0,0 +1,314 @@
+package formLayout
+
+// Layout of an answer sheet declared in assets/layouts/<name>.json. It's used both to print sheets and
+// to read them, rectangles are given in parts of the page width and height from its top left corner.
+// Every paper size and orientation has its own layout, they are told apart by the ratio of the distances
+// between the fiducial squares, so the ratios of layouts must differ by a tenth or more.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+const LAYOUTS_FOLDER = "assets/layouts"
+const DEFAULT_LAYOUT = "a4"
+
+// roles of the fields
+const ROLE_USER_ID = "userID"
+const ROLE_TEST_ID = "testID"
+const ROLE_ANSWER = "answer"
+const ROLE_VARIANT = "variant"
+
+// BLANK_CELL stands for a blank cell inside a value, blank cells at the end of a field aren't kept,
+// so an answer left blank is empty and a written zero is "0"
+const BLANK_CELL = "_"
+
+type Rect struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	W float64 `json:"w"`
+	H float64 `json:"h"`
+}
+
+type Field struct {
+	Role string `json:"role"`
+	Question int `json:"question,omitempty"` // number of the question of answer fields, from 1
+	Label string `json:"label,omitempty"`
+	Cells int `json:"cells"` // the most digits of a free-form field
+	FreeForm bool `json:"freeForm,omitempty"` // no cells are printed, digits are found wherever they're written
+	Margin float64 `json:"margin"` // part of the field height left out of every cell, so the border isn't read
+	Cancel *Rect `json:"cancel,omitempty"` // box left of an answer field, a tick in it voids the answer
+	Rect
+}
+
+type Layout struct {
+	Name string `json:"name"`
+	Title string `json:"title"`
+	Width float64 `json:"width"` // page size in millimeters
+	Height float64 `json:"height"`
+	Squares [3]Rect `json:"squares"` // top left, top right and bottom right fiducial squares
+	Caption Rect `json:"caption"` // line for the test and student names
+	Code Rect `json:"code"` // timing-mark code, the upper half is the timing row
+	Fields []Field `json:"fields"`
+}
+
+// Values are the values read from the fields of a sheet
+type Values struct {
+	UserID string
+	TestID string
+	Variant string
+	Answers []string // Answers[i] is the answer to the question i+1
+	Fields []FieldReading // in the order of the layout
+}
+
+// CellReading is the recognition of one digit written in the field or of a blank cell, Digit is 10 for a blank cell
+// which has no Probabilities, its confidence tells how sure the blank cell detector is
+type CellReading struct {
+	Digit int
+	Void bool // the digit is crossed out or scribbled over, it's left out of the value
+	Probabilities []float64 // of the digits 0-9
+	Confidence float64
+}
+
+// FieldReading is the recognition of one field, its confidence is the one of its least confident cell
+type FieldReading struct {
+	Role string
+	Question int
+	Value string
+	Confidence float64
+	Cancelled bool // the cancel box of the field is ticked, the value is empty
+	Cells []CellReading // in the order of writing, a cell of the grid may have a few digits when some are crossed out
+	Image string // name of the crop of the field saved to src, it's shown for review
+}
+
+func (rect *Rect) Center() (float64, float64) {
+	return rect.X + rect.W/2, rect.Y + rect.H/2
+}
+
+// Outline is the rectangle around the field and its cancel box
+func (field *Field) Outline() Rect {
+	if field.Cancel == nil {
+		return field.Rect
+	}
+	x := math.Min(field.X, field.Cancel.X)
+	y := math.Min(field.Y, field.Cancel.Y)
+	return Rect{
+		X: x,
+		Y: y,
+		W: math.Max(field.X+field.W, field.Cancel.X+field.Cancel.W) - x,
+		H: math.Max(field.Y+field.H, field.Cancel.Y+field.Cancel.H) - y,
+	}
+}
+
+// Cancellable tells whether the layout has cancel boxes
+func (layout *Layout) Cancellable() bool {
+	for _, field := range layout.Fields {
+		if field.Cancel != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Legs are the distances in millimeters from the top right square to the top left and to the bottom right ones
+func (layout *Layout) Legs() (float64, float64) {
+	left, top := layout.Squares[0].Center()
+	right, _ := layout.Squares[1].Center()
+	_, bottom := layout.Squares[2].Center()
+	return (right - left) * layout.Width, (bottom - top) * layout.Height
+}
+
+// Landscape tells whether the horizontal leg is the longer one
+func (layout *Layout) Landscape() bool {
+	horizontal, vertical := layout.Legs()
+	return horizontal > vertical
+}
+
+// LegsRatio is the ratio of the longer leg to the shorter one, it doesn't depend on the scale and rotation of a photo
+func (layout *Layout) LegsRatio() float64 {
+	horizontal, vertical := layout.Legs()
+	return math.Max(horizontal, vertical) / math.Min(horizontal, vertical)
+}
+
+// Questions is the number of answer fields
+func (layout *Layout) Questions() int {
+	questions := 0
+	for _, field := range layout.Fields {
+		if field.Role == ROLE_ANSWER && field.Question > questions {
+			questions = field.Question
+		}
+	}
+	return questions
+}
+
+// Validate checks that the fields can be read, every role but answers is expected once
+func (layout *Layout) Validate() error {
+	if layout.Width <= 0 || layout.Height <= 0 {
+		return errors.New(fmt.Sprintf("Layout %s has no page size", layout.Name))
+	}
+	if horizontal, vertical := layout.Legs(); horizontal <= 0 || vertical <= 0 {
+		return errors.New(fmt.Sprintf("Squares of layout %s aren't top left, top right and bottom right", layout.Name))
+	}
+	roles := make(map[string]int)
+	questions := make(map[int]bool)
+	for i, field := range layout.Fields {
+		if field.Cells <= 0 || field.W <= 0 || field.H <= 0 {
+			return errors.New(fmt.Sprintf("Field %d of layout %s is empty", i+1, layout.Name))
+		}
+		switch field.Role {
+		case ROLE_USER_ID, ROLE_TEST_ID, ROLE_VARIANT:
+			roles[field.Role]++
+		case ROLE_ANSWER:
+			if field.Question <= 0 || questions[field.Question] {
+				return errors.New(fmt.Sprintf("Field %d of layout %s has wrong question number %d", i+1, layout.Name, field.Question))
+			}
+			questions[field.Question] = true
+		default:
+			return errors.New(fmt.Sprintf("Field %d of layout %s has unknown role %s", i+1, layout.Name, field.Role))
+		}
+		if field.Cancel != nil && (field.Role != ROLE_ANSWER || field.Cancel.W <= 0 || field.Cancel.H <= 0) {
+			return errors.New(fmt.Sprintf("Field %d of layout %s can't have a cancel box", i+1, layout.Name))
+		}
+	}
+	for _, role := range []string{ROLE_USER_ID, ROLE_TEST_ID, ROLE_VARIANT} {
+		if roles[role] != 1 {
+			return errors.New(fmt.Sprintf("Layout %s must have one %s field", layout.Name, role))
+		}
+	}
+	return nil
+}
+
+// Collect puts values of the readings by the roles of their fields
+func Collect(readings []FieldReading) *Values {
+	result := &Values{Fields: readings}
+	for _, reading := range readings {
+		switch reading.Role {
+		case ROLE_USER_ID:
+			result.UserID = reading.Value
+		case ROLE_TEST_ID:
+			result.TestID = reading.Value
+		case ROLE_VARIANT:
+			result.Variant = reading.Value
+		case ROLE_ANSWER:
+			for len(result.Answers) < reading.Question {
+				result.Answers = append(result.Answers, "")
+			}
+			result.Answers[reading.Question-1] = reading.Value
+		}
+	}
+	return result
+}
+
+// SetDecoded replaces the value of the field of the role with the one read reliably, e.g. from the sheet code
+func (values *Values) SetDecoded(role, value string) {
+	switch role {
+	case ROLE_USER_ID:
+		values.UserID = value
+	case ROLE_TEST_ID:
+		values.TestID = value
+	case ROLE_VARIANT:
+		values.Variant = value
+	}
+	for i := range values.Fields {
+		if values.Fields[i].Role == role {
+			values.Fields[i].Value = value
+			values.Fields[i].Confidence = 1
+		}
+	}
+}
+
+// FieldName is how the field of the role is called to teachers
+func FieldName(role string, question int) string {
+	switch role {
+	case ROLE_USER_ID:
+		return "student ID"
+	case ROLE_TEST_ID:
+		return "test ID"
+	case ROLE_VARIANT:
+		return "variant"
+	}
+	return fmt.Sprintf("answer %d", question)
+}
+
+// ShowBlanks makes the blank cells of the value visible to people
+func ShowBlanks(value string) string {
+	if value == "" {
+		return "blank"
+	}
+	return strings.ReplaceAll(value, BLANK_CELL, "␣")
+}
+
+// LowConfidence names the ID fields and the answers to the first questions that were read less confidently than the threshold,
+// the variant field matters only when the test has a few variants
+func (values *Values) LowConfidence(threshold float64, questions, variants int) []string {
+	reasons := make([]string, 0)
+	for _, reading := range values.Fields {
+		if reading.Confidence >= threshold {
+			continue
+		}
+		if reading.Role == ROLE_VARIANT && variants == 1 || reading.Role == ROLE_ANSWER && reading.Question > questions {
+			continue
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %s (%.0f%%)", FieldName(reading.Role, reading.Question), ShowBlanks(reading.Value), reading.Confidence*100))
+	}
+	return reasons
+}
+
+func GetLayout(name string) (*Layout, error) {
+	if name == "" || strings.ContainsAny(name, "/\\.") {
+		return nil, errors.New(fmt.Sprintf("Wrong layout name %s", name))
+	}
+	data, err := os.ReadFile(LAYOUTS_FOLDER + "/" + name + ".json")
+	if err != nil {
+		return nil, err
+	}
+	layout := &Layout{}
+	err = json.Unmarshal(data, layout)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Layout %s is broken: %s", name, err.Error()))
+	}
+	err = layout.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// GetLayouts returns all layouts sorted by their names
+func GetLayouts() ([]*Layout, error) {
+	entries, err := os.ReadDir(LAYOUTS_FOLDER)
+	if err != nil {
+		return nil, err
+	}
+	layouts := make([]*Layout, 0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		layout, err := GetLayout(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		layouts = append(layouts, layout)
+	}
+	sort.Slice(layouts, func(i, j int) bool {
+		return layouts[i].Name < layouts[j].Name
+	})
+	return layouts, nil
+}
+
+// ChooseLayout finds the layout with the nearest ratio of legs
+func ChooseLayout(layouts []*Layout, ratio float64) *Layout {
+	var best *Layout
+	for _, layout := range layouts {
+		if best == nil || math.Abs(layout.LegsRatio()-ratio) < math.Abs(best.LegsRatio()-ratio) {
+			best = layout
+		}
+	}
+	return best
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type GradingScale struct {
+	Name string
+	Percentage bool // bounds are percents of the maximum points, otherwise they're points
+	Marks []string // from the lowest to the highest
+	Bounds []int // Bounds[i] is the least result to get Marks[i+1]
+}
+
+type MarkBound struct {
+	Mark string
+	Points string // least points to get the mark
+}
+
+const GRADING_SCALES_FILE = "tester/gradingScales.txt"
+
+var GradingScalesMutex sync.Mutex
+
+var defaultGradingScales = []GradingScale{
+	GradingScale{Name: "2-5", Percentage: true, Marks: []string{"2", "3", "4", "5"}, Bounds: []int{50, 70, 85}},
+	GradingScale{Name: "1-10", Percentage: true, Marks: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}, Bounds: []int{10, 20, 30, 40, 50, 60, 70, 80, 90}},
+	GradingScale{Name: "A-F", Percentage: true, Marks: []string{"F", "E", "D", "C", "B", "A"}, Bounds: []int{50, 60, 70, 80, 90}},
+	GradingScale{Name: "pass/fail", Percentage: true, Marks: []string{"fail", "pass"}, Bounds: []int{50}},
+}
+
+// LegacyGradingScale converts thresholds of tests created before grading scales were introduced
+func LegacyGradingScale(pointsToMark [3]int) GradingScale {
+	return GradingScale{
+		Name: "2-5",
+		Percentage: false,
+		Marks: []string{"2", "3", "4", "5"},
+		Bounds: []int{pointsToMark[0], pointsToMark[1], pointsToMark[2]},
+	}
+}
+
+// Mark returns the mark for the points, maxPoints are used by percentage scales
+func (scale *GradingScale) Mark(points, maxPoints int) string {
+	if len(scale.Marks) == 0 {
+		return ""
+	}
+	mark := 0
+	for _, bound := range scale.Bounds {
+		if scale.Percentage && points*100 >= bound*maxPoints || !scale.Percentage && points >= bound {
+			mark++
+		}
+	}
+	return scale.Marks[mark]
+}
+
+// MarkBounds returns the least points needed for every mark
+func (scale *GradingScale) MarkBounds(maxPoints int) []MarkBound {
+	bounds := make([]MarkBound, len(scale.Marks))
+	for i, mark := range scale.Marks {
+		bounds[i].Mark = mark
+		bounds[i].Points = "0"
+		if i > 0 {
+			points := scale.Bounds[i-1]
+			if scale.Percentage {
+				// rounding up, as the mark is received when points*100 >= bound*maxPoints
+				points = (points*maxPoints + 99) / 100
+			}
+			bounds[i].Points = fmt.Sprint(points)
+		}
+	}
+	return bounds
+}
+
+// BoundsString is used to fill bounds inputs of the forms
+func (scale *GradingScale) BoundsString() string {
+	strs := make([]string, len(scale.Bounds))
+	for i, bound := range scale.Bounds {
+		strs[i] = fmt.Sprint(bound)
+	}
+	return strings.Join(strs, " ")
+}
+
+func (scale *GradingScale) MarksString() string {
+	return strings.Join(scale.Marks, " ")
+}
+
+// ParseBounds sets bounds from the space separated string, there must be one bound less than marks
+func (scale *GradingScale) ParseBounds(str string) error {
+	strs := strings.Fields(str)
+	if len(strs) != len(scale.Marks)-1 {
+		return errors.New(fmt.Sprintf("Scale %s needs %d bounds, %d given", scale.Name, len(scale.Marks)-1, len(strs)))
+	}
+	bounds := make([]int, len(strs))
+	for i, s := range strs {
+		bound, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		bounds[i] = bound
+	}
+	scale.Bounds = bounds
+	return nil
+}
+
+// Validate checks that every mark can be received: bounds grow from more than zero and percents are at most 100
+func (scale *GradingScale) Validate() error {
+	for i, bound := range scale.Bounds {
+		if bound <= 0 {
+			return errors.New(fmt.Sprintf("Bound %d of scale %s must be more than zero, or mark %s can't be received", bound, scale.Name, scale.Marks[i]))
+		}
+		if scale.Percentage && bound > 100 {
+			return errors.New(fmt.Sprintf("Bound %d%% of scale %s is more than 100%%", bound, scale.Name))
+		}
+		if i > 0 && bound <= scale.Bounds[i-1] {
+			return errors.New(fmt.Sprintf("Bounds of scale %s must grow, %d follows %d, so mark %s can't be received", scale.Name, bound, scale.Bounds[i-1], scale.Marks[i]))
+		}
+	}
+	return nil
+}
+
+// writeGradingScale and readGradingScale are used both for scales file and for test files
+func writeGradingScale(scale *GradingScale) string {
+	out := fmt.Sprintf("Scale: %s\n", scale.Name)
+	out += fmt.Sprintf("Percentage: %v\n", scale.Percentage)
+	out += fmt.Sprintf("Marks: %s\n", scale.MarksString())
+	out += fmt.Sprintf("Bounds: %s\n", scale.BoundsString())
+	return out
+}
+
+// readGradingScale expects that the "Scale: " line has already been scanned
+func readGradingScale(scanner *bufio.Scanner) (GradingScale, error) {
+	var scale GradingScale
+	scale.Name = scanner.Text()[len("Scale: "):]
+	scanner.Scan()
+	scale.Percentage = scanner.Text()[len("Percentage: "):] == "true"
+	scanner.Scan()
+	scale.Marks = strings.Fields(scanner.Text()[len("Marks: "):])
+	scanner.Scan()
+	if len(scale.Marks) == 0 {
+		return scale, errors.New(fmt.Sprintf("Scale %s has no marks", scale.Name))
+	}
+	err := scale.ParseBounds(scanner.Text()[len("Bounds: "):])
+	return scale, err
+}
+
+// GetGradingScales returns all school-wide grading scales and the name of the default one
+func GetGradingScales() ([]GradingScale, string, error) {
+	GradingScalesMutex.Lock()
+	defer GradingScalesMutex.Unlock()
+
+	f, err := os.Open(GRADING_SCALES_FILE)
+	if os.IsNotExist(err) {
+		return defaultGradingScales, defaultGradingScales[0].Name, nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	defaultName := scanner.Text()[len("Default: "):]
+	scanner.Scan()
+	n, err := strconv.Atoi(scanner.Text()[len("Scales ("):len(scanner.Text())-1])
+	if err != nil {
+		return nil, "", err
+	}
+	scales := make([]GradingScale, n)
+	for i := range scales {
+		scanner.Scan()
+		scales[i], err = readGradingScale(scanner)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return scales, defaultName, scanner.Err()
+}
+
+func SaveGradingScales(scales []GradingScale, defaultName string) error {
+	GradingScalesMutex.Lock()
+	defer GradingScalesMutex.Unlock()
+
+	out := fmt.Sprintf("Default: %s\n", defaultName)
+	out += fmt.Sprintf("Scales (%d)\n", len(scales))
+	for i := range scales {
+		out += writeGradingScale(&scales[i])
+	}
+	return os.WriteFile(GRADING_SCALES_FILE, []byte(out), 0600)
+}
+
+// GetGradingScale finds school-wide scale by name, the default scale is returned for unknown names
+func GetGradingScale(name string) (GradingScale, error) {
+	scales, defaultName, err := GetGradingScales()
+	if err != nil {
+		return GradingScale{}, err
+	}
+	if name == "" {
+		name = defaultName
+	}
+	for _, scale := range scales {
+		if scale.Name == name {
+			return scale, nil
+		}
+	}
+	for _, scale := range scales {
+		if scale.Name == defaultName {
+			return scale, nil
+		}
+	}
+	if len(scales) == 0 {
+		return GradingScale{}, errors.New("There are no grading scales")
+	}
+	return scales[0], nil
+}
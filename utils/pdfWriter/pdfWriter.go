@@ -0,0 +1,136 @@
+package pdfWriter
+
+// Minimal PDF writer for printable forms: filled rectangles, (dashed) lines and text of standard fonts.
+// Coordinates are given in points from the top left corner of the page.
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const MM = 72. / 25.4 // points in a millimeter
+
+// standard fonts, they are not embedded so only Latin-1 text can be written
+const FONT_REGULAR = "F1"
+const FONT_BOLD = "F2"
+
+type Page struct {
+	height float64
+	content bytes.Buffer
+}
+
+type Document struct {
+	Width, Height float64
+	pages []*Page
+}
+
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+func (doc *Document) AddPage() *Page {
+	page := &Page{height: doc.Height}
+	doc.pages = append(doc.pages, page)
+	return page
+}
+
+// SetGray sets color of filling and stroking, 0 is black and 1 is white
+func (page *Page) SetGray(gray float64) {
+	fmt.Fprintf(&page.content, "%.3f g %.3f G\n", gray, gray)
+}
+
+func (page *Page) FillRect(x, y, w, h float64) {
+	fmt.Fprintf(&page.content, "%.2f %.2f %.2f %.2f re f\n", x, page.height-y-h, w, h)
+}
+
+// Line draws a line of the width, dash is the length of dashes and gaps, 0 means a solid line
+func (page *Page) Line(x1, y1, x2, y2, width, dash float64) {
+	if dash > 0 {
+		fmt.Fprintf(&page.content, "[%.2f %.2f] 0 d\n", dash, dash/2)
+	} else {
+		page.content.WriteString("[] 0 d\n")
+	}
+	fmt.Fprintf(&page.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, page.height-y1, x2, page.height-y2)
+}
+
+// Polyline draws a solid line through the points (x1, y1, x2, y2, ...) with rounded ends and joins
+func (page *Page) Polyline(width float64, points ...float64) {
+	if len(points) < 4 {
+		return
+	}
+	fmt.Fprintf(&page.content, "[] 0 d 1 J 1 j %.2f w %.2f %.2f m", width, points[0], page.height-points[1])
+	for i := 2; i+1 < len(points); i += 2 {
+		fmt.Fprintf(&page.content, " %.2f %.2f l", points[i], page.height-points[i+1])
+	}
+	page.content.WriteString(" S 0 J 0 j\n")
+}
+
+func (page *Page) StrokeRect(x, y, w, h, width, dash float64) {
+	page.Line(x, y, x+w, y, width, dash)
+	page.Line(x+w, y, x+w, y+h, width, dash)
+	page.Line(x+w, y+h, x, y+h, width, dash)
+	page.Line(x, y+h, x, y, width, dash)
+}
+
+// Text writes the text with its baseline at y
+func (page *Page) Text(x, y, size float64, font, text string) {
+	fmt.Fprintf(&page.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, page.height-y, escape(text))
+}
+
+// escape makes a PDF string literal, characters out of Latin-1 are replaced with '?'
+func escape(text string) string {
+	var out strings.Builder
+	for _, c := range text {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(c)
+		case c < 32 || c > 255:
+			out.WriteByte('?')
+		case c > 126:
+			fmt.Fprintf(&out, "\\%03o", c)
+		default:
+			out.WriteRune(c)
+		}
+	}
+	return out.String()
+}
+
+// TextWidth estimates the width of the text, digits and capitals of Helvetica are about 0.6 of the size
+func TextWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * 0.6
+}
+
+func (doc *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	offsets := make([]int, 0)
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1 catalog, 2 pages, 3-4 fonts, then a page and its content for every page
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(doc.pages))
+	for i := range doc.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(doc.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range doc.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>", doc.Width, doc.Height, FONT_REGULAR, FONT_BOLD, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.WriteTo(w)
+}
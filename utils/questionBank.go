@@ -0,0 +1,355 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const QUESTION_BANK_FOLDER = "tester/questionBank"
+
+const MIN_DIFFICULTY = 1
+const MAX_DIFFICULTY = 5
+
+var QuestionBankMutex sync.Mutex
+
+// BankResult is a grading of a bank question in one student's result of one test
+type BankResult struct {
+	Key string // testID$username, regrading and rechecking replace the previous grading
+	Points int
+	MaxPoints int
+}
+
+type BankQuestion struct {
+	ID string
+	Owner string // username of the teacher who added the question
+	Shared bool // shared questions are visible to all teachers
+	Answer string
+	Points int
+	Credit string // one of CreditPolicies
+	Penalty int
+	Tags []string
+	Difficulty int // from MIN_DIFFICULTY to MAX_DIFFICULTY
+	Results []BankResult
+}
+
+type BankQuestionStats struct {
+	Tests int // number of tests which were checked with the question
+	Attempts int
+	FullyCorrect int
+	AveragePercent string
+}
+
+// Stats aggregates gradings of the question across all tests using it
+func (q *BankQuestion) Stats() BankQuestionStats {
+	var stats BankQuestionStats
+	tests := make(map[string]bool)
+	points, maxPoints := 0, 0
+	for _, res := range q.Results {
+		tests[res.Key[:strings.Index(res.Key, "$")]] = true
+		stats.Attempts++
+		if res.Points >= res.MaxPoints {
+			stats.FullyCorrect++
+		}
+		points += res.Points
+		maxPoints += res.MaxPoints
+	}
+	stats.Tests = len(tests)
+	stats.AveragePercent = "-"
+	if maxPoints > 0 {
+		stats.AveragePercent = fmt.Sprintf("%.1f", float64(points)*100/float64(maxPoints))
+	}
+	return stats
+}
+
+func (q *BankQuestion) TagsString() string {
+	return strings.Join(q.Tags, " ")
+}
+
+func (q *BankQuestion) HasTag(tag string) bool {
+	for _, t := range q.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// VisibleTo tells whether the teacher can see the question and use it in tests
+func (q *BankQuestion) VisibleTo(username string) bool {
+	return q.Shared || q.Owner == username
+}
+
+// ToQuestion makes a question of a test which remembers where it was taken from
+func (q *BankQuestion) ToQuestion() Question {
+	return Question{
+		Answer: q.Answer,
+		Answers: []string{q.Answer},
+		Points: q.Points,
+		Credit: q.Credit,
+		Penalty: q.Penalty,
+		BankID: q.ID,
+	}
+}
+
+// ParseTags splits the tags string, tags are lowercased and repetitions are removed
+func ParseTags(str string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tag := range strings.Fields(strings.ToLower(str)) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// IsBankQuestionID tells whether the ID can be one of a bank question, IDs from forms and URLs
+// are checked with it, so they can't point outside the bank folder
+func IsBankQuestionID(id string) bool {
+	return id != "" && strings.Trim(id, "0123456789") == ""
+}
+
+func bankQuestionPath(id string) string {
+	return fmt.Sprintf("%s/%s.txt", QUESTION_BANK_FOLDER, id)
+}
+
+// prepareQuestionBankFolder creates the folder of the bank on the first use
+func prepareQuestionBankFolder() error {
+	if _, err := os.Stat(QUESTION_BANK_FOLDER + "/currentID.txt"); err == nil {
+		return nil
+	}
+	err := os.MkdirAll(QUESTION_BANK_FOLDER, 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(QUESTION_BANK_FOLDER+"/currentID.txt", []byte("0"), 0600)
+}
+
+func saveBankQuestionToFile(q *BankQuestion) error {
+	out := fmt.Sprintf("Owner: %s\n", q.Owner)
+	out += fmt.Sprintf("Shared: %v\n", q.Shared)
+	out += fmt.Sprintf("Answer: %s\n", q.Answer)
+	out += fmt.Sprintf("Scoring: %d %s %d\n", q.Points, q.Credit, q.Penalty)
+	out += fmt.Sprintf("Tags: %s\n", q.TagsString())
+	out += fmt.Sprintf("Difficulty: %d\n", q.Difficulty)
+	out += fmt.Sprintf("Results (%d)\n", len(q.Results))
+	for _, res := range q.Results {
+		out += fmt.Sprintf("%s %d %d\n", res.Key, res.Points, res.MaxPoints)
+	}
+	return os.WriteFile(bankQuestionPath(q.ID), []byte(out), 0600)
+}
+
+// scanBankLine returns the next line of the question file without its prefix
+func scanBankLine(scanner *bufio.Scanner, id, prefix string) (string, error) {
+	scanner.Scan()
+	line := scanner.Text()
+	if !strings.HasPrefix(line, prefix) {
+		return "", errors.New(fmt.Sprintf("Bank question %s is corrupted, \"%s\" line is missing", id, strings.TrimSpace(prefix)))
+	}
+	return line[len(prefix):], nil
+}
+
+func getBankQuestionFromFile(id string) (*BankQuestion, error) {
+	if !IsBankQuestionID(id) {
+		return nil, errors.New(fmt.Sprintf("Wrong bank question ID %s", id))
+	}
+	f, err := os.Open(bankQuestionPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	q := &BankQuestion{ID: id}
+	lines := make(map[string]string)
+	for _, prefix := range []string{"Owner: ", "Shared: ", "Answer: ", "Scoring: ", "Tags: ", "Difficulty: ", "Results ("} {
+		lines[prefix], err = scanBankLine(scanner, id, prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+	q.Owner = lines["Owner: "]
+	q.Shared = lines["Shared: "] == "true"
+	q.Answer = lines["Answer: "]
+	scoring := strings.Fields(lines["Scoring: "])
+	if len(scoring) != 3 {
+		return nil, errors.New(fmt.Sprintf("Bank question %s has corrupted scoring", id))
+	}
+	q.Points, _ = strconv.Atoi(scoring[0])
+	q.Credit = scoring[1]
+	q.Penalty, _ = strconv.Atoi(scoring[2])
+	q.Tags = ParseTags(lines["Tags: "])
+	q.Difficulty, _ = strconv.Atoi(lines["Difficulty: "])
+	n, err := strconv.Atoi(strings.TrimSuffix(lines["Results ("], ")"))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bank question %s has corrupted results", id))
+	}
+	q.Results = make([]BankResult, n)
+	for i := range q.Results {
+		scanner.Scan()
+		s := strings.Fields(scanner.Text())
+		if len(s) != 3 {
+			return nil, errors.New(fmt.Sprintf("Bank question %s has corrupted results", id))
+		}
+		q.Results[i].Key = s[0]
+		q.Results[i].Points, _ = strconv.Atoi(s[1])
+		q.Results[i].MaxPoints, _ = strconv.Atoi(s[2])
+	}
+	return q, scanner.Err()
+}
+
+func GetBankQuestion(id string) (*BankQuestion, error) {
+	QuestionBankMutex.Lock()
+	defer QuestionBankMutex.Unlock()
+	return getBankQuestionFromFile(id)
+}
+
+// GetBankQuestions returns all questions of the bank visible to the teacher ordered by ID
+func GetBankQuestions(username string) ([]BankQuestion, error) {
+	QuestionBankMutex.Lock()
+	defer QuestionBankMutex.Unlock()
+
+	entries, err := os.ReadDir(QUESTION_BANK_FOLDER)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	questions := make([]BankQuestion, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "currentID.txt" || !strings.HasSuffix(name, ".txt") {
+			continue
+		}
+		q, err := getBankQuestionFromFile(name[:len(name)-len(".txt")])
+		if err != nil {
+			return nil, err
+		}
+		if q.VisibleTo(username) {
+			questions = append(questions, *q)
+		}
+	}
+	sort.Slice(questions, func(i, j int) bool {
+		return questions[i].ID < questions[j].ID
+	})
+	return questions, nil
+}
+
+// SaveBankQuestion creates a new question when its ID is empty, statistics of existing questions are kept
+func SaveBankQuestion(q *BankQuestion) error {
+	QuestionBankMutex.Lock()
+	defer QuestionBankMutex.Unlock()
+
+	if q.ID == "" {
+		err := prepareQuestionBankFolder()
+		if err != nil {
+			return err
+		}
+		q.ID, err = GetCurrentlyFreeID(QUESTION_BANK_FOLDER, 6)
+		if err != nil {
+			return err
+		}
+		q.Results = nil
+	} else {
+		previous, err := getBankQuestionFromFile(q.ID)
+		if err != nil {
+			return err
+		}
+		q.Results = previous.Results
+	}
+	return saveBankQuestionToFile(q)
+}
+
+func DeleteBankQuestion(id string) error {
+	if !IsBankQuestionID(id) {
+		return errors.New(fmt.Sprintf("Wrong bank question ID %s", id))
+	}
+	QuestionBankMutex.Lock()
+	defer QuestionBankMutex.Unlock()
+	return os.Remove(bankQuestionPath(id))
+}
+
+// RecordBankStatistics saves grading of bank questions in the student's result of the test
+func RecordBankStatistics(test *Test, results *PersonalTest) error {
+	QuestionBankMutex.Lock()
+	defer QuestionBankMutex.Unlock()
+
+	key := test.ID + "$" + results.UserName
+	for i, question := range test.Questions {
+		if question.BankID == "" || i >= len(results.Questions) {
+			continue
+		}
+		q, err := getBankQuestionFromFile(question.BankID)
+		if os.IsNotExist(err) {
+			// question has been deleted from the bank
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		res := BankResult{Key: key, MaxPoints: question.Points}
+		res.Points, _ = strconv.Atoi(results.Questions[i].Points)
+		replaced := false
+		for j := range q.Results {
+			if q.Results[j].Key == key {
+				q.Results[j] = res
+				replaced = true
+			}
+		}
+		if !replaced {
+			q.Results = append(q.Results, res)
+		}
+		err = saveBankQuestionToFile(q)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteBankStatistics removes results of the test from the statistics of the bank,
+// all questions are looked through as earlier versions of the test may have linked other ones
+func DeleteBankStatistics(testID string) error {
+	QuestionBankMutex.Lock()
+	defer QuestionBankMutex.Unlock()
+
+	entries, err := os.ReadDir(QUESTION_BANK_FOLDER)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "currentID.txt" || !strings.HasSuffix(name, ".txt") {
+			continue
+		}
+		q, err := getBankQuestionFromFile(name[:len(name)-len(".txt")])
+		if err != nil {
+			return err
+		}
+		results := make([]BankResult, 0, len(q.Results))
+		for _, res := range q.Results {
+			if !strings.HasPrefix(res.Key, testID+"$") {
+				results = append(results, res)
+			}
+		}
+		if len(results) == len(q.Results) {
+			continue
+		}
+		q.Results = results
+		err = saveBankQuestionToFile(q)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tucklejudge/utils/formLayout"
+)
+
+// DEFAULT_REVIEW_THRESHOLD is the least confidence in percents of recognized IDs and answers which isn't reviewed
+const DEFAULT_REVIEW_THRESHOLD = 80
+
+// RecognizedField keeps the recognized value of a field next to the correction of the teacher,
+// so the sheets can be audited and the crops with right values can be used to train recognition
+type RecognizedField struct {
+	Role string
+	Question int
+	Value string // as it was recognized
+	Confidence float64
+	ImageName string // crop of the field in src
+	Corrected bool
+	Correction string
+}
+
+type ReviewItem struct {
+	TestID string
+	TestName string
+	Username string
+	FullName string
+	Reasons []string
+}
+
+// RecognizedFields keeps the readings of the fields of a sheet
+func RecognizedFields(readings []formLayout.FieldReading) []RecognizedField {
+	fields := make([]RecognizedField, len(readings))
+	for i, reading := range readings {
+		fields[i] = RecognizedField{
+			Role: reading.Role,
+			Question: reading.Question,
+			Value: reading.Value,
+			Confidence: reading.Confidence,
+			ImageName: reading.Image,
+		}
+	}
+	return fields
+}
+
+func (field *RecognizedField) Name() string {
+	return formLayout.FieldName(field.Role, field.Question)
+}
+
+// Current is the value of the field that is graded
+func (field *RecognizedField) Current() string {
+	if field.Corrected {
+		return field.Correction
+	}
+	return field.Value
+}
+
+func (field *RecognizedField) ValueForTemplate() string {
+	return formLayout.ShowBlanks(field.Value)
+}
+
+func (field *RecognizedField) ConfidenceForTemplate() string {
+	return fmt.Sprintf("%.0f%%", field.Confidence*100)
+}
+
+// Editable tells whether the teacher can correct the field, results can't be moved to another student or test
+func (field *RecognizedField) Editable() bool {
+	return field.Role == formLayout.ROLE_ANSWER || field.Role == formLayout.ROLE_VARIANT
+}
+
+// empty values are saved as "-"
+func dashIfEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func emptyIfDash(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// String is the line of the field in the result file: role, question, value, confidence, image and the correction if any
+func (field *RecognizedField) String() string {
+	out := fmt.Sprintf("%s %d %s %.3f %s", field.Role, field.Question, dashIfEmpty(field.Value), field.Confidence, dashIfEmpty(field.ImageName))
+	if field.Corrected {
+		out += " " + dashIfEmpty(field.Correction)
+	}
+	return out
+}
+
+func (field *RecognizedField) parse(line string) error {
+	s := strings.Split(line, " ")
+	if len(s) != 5 && len(s) != 6 {
+		return errors.New(fmt.Sprintf("wrong field %s", line))
+	}
+	var err error
+	field.Role = s[0]
+	field.Question, err = strconv.Atoi(s[1])
+	if err != nil {
+		return err
+	}
+	field.Value = emptyIfDash(s[2])
+	field.Confidence, err = strconv.ParseFloat(s[3], 64)
+	if err != nil {
+		return err
+	}
+	field.ImageName = emptyIfDash(s[4])
+	field.Corrected = len(s) == 6
+	if field.Corrected {
+		field.Correction = emptyIfDash(s[5])
+	}
+	return nil
+}
+
+// ParseReviewThreshold converts percents from a form to a confidence, an empty value means the default threshold
+func ParseReviewThreshold(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DEFAULT_REVIEW_THRESHOLD / 100., nil
+	}
+	percents, err := strconv.Atoi(value)
+	if err != nil || percents < 0 || percents > 100 {
+		return 0, errors.New(fmt.Sprintf("Review threshold must be a number of percents from 0 to 100, not %s", value))
+	}
+	return float64(percents) / 100., nil
+}
+
+// GetReviewQueue returns results waiting for review in the tests the user can check
+func GetReviewQueue(username string) ([]ReviewItem, error) {
+	user, err := GetAccauntInfo(username)
+	if err != nil {
+		return nil, err
+	}
+	queue := make([]ReviewItem, 0)
+	for _, id := range user.Tests {
+		// the list of a teacher has checks too, their IDs are longer
+		if len(id) != 4 {
+			continue
+		}
+		test, err := GetTestByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if !HasTestRight(&test, username, RIGHT_CHECK) {
+			continue
+		}
+		students, err := GetTestResultsUsernames(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, student := range students {
+			results, err := GetTestUsersResultByID(id, student)
+			if err != nil {
+				return nil, err
+			}
+			if len(results.Review) == 0 {
+				continue
+			}
+			item := ReviewItem{TestID: id, TestName: test.Name, Username: student, FullName: student, Reasons: results.Review}
+			if info, err := GetAccauntInfo(student); err == nil {
+				item.FullName = info.Surname + " " + info.Name
+			}
+			queue = append(queue, item)
+		}
+	}
+	return queue, nil
+}
+
+// ApproveResult takes the result out of the review queue, so its mark is shown to the student
+func ApproveResult(testID, username string) error {
+	results, err := GetTestUsersResultByID(testID, username)
+	if err != nil {
+		return err
+	}
+	results.Review = nil
+	err = CreateTestResultFile(testID+"$"+username, results)
+	if err != nil {
+		return err
+	}
+	return updateShortResults(testID, username, func(result *PersonalResult) bool {
+		changed := result.NeedsReview
+		result.NeedsReview = false
+		return changed
+	})
+}
+
+// SheetAnswers are all the answers of the sheet with the corrections of the teacher, not only the ones to the questions
+// of the key it was graded with, so the questions added to the key later are graded with the answers written to them
+func (results *PersonalTest) SheetAnswers() []string {
+	answers := append([]string{}, results.RecognizedAnswers...)
+	for _, field := range results.Fields {
+		if field.Role != formLayout.ROLE_ANSWER || field.Question < 1 {
+			continue
+		}
+		for len(answers) < field.Question {
+			answers = append(answers, "")
+		}
+		answers[field.Question-1] = field.Current()
+	}
+	return answers
+}
+
+// CorrectResult grades the result again with the values of the fields corrected by the teacher, corrections[i] is
+// the value of the field i, fields that aren't in it stay the same. The result is reviewed after that.
+func CorrectResult(testID, username string, corrections map[int]string) (*PersonalTest, error) {
+	test, err := GetTestByID(testID)
+	if err != nil {
+		return nil, err
+	}
+	results, err := GetTestUsersResultByID(testID, username)
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range corrections {
+		if i < 0 || i >= len(results.Fields) || !results.Fields[i].Editable() {
+			return nil, errors.New(fmt.Sprintf("Field %d of the result can't be corrected", i+1))
+		}
+		field := &results.Fields[i]
+		value = strings.TrimRight(strings.TrimSpace(value), formLayout.BLANK_CELL)
+		for _, c := range value {
+			if (c < '0' || c > '9') && string(c) != formLayout.BLANK_CELL {
+				return nil, errors.New(fmt.Sprintf("Value %s of %s isn't made of digits and blank cells %s", value, field.Name(), formLayout.BLANK_CELL))
+			}
+		}
+		// a correction to the recognized value is no correction
+		field.Corrected = value != field.Value
+		field.Correction = value
+		if !field.Corrected {
+			field.Correction = ""
+		}
+	}
+	variant, err := strconv.Atoi(results.Variant)
+	if err != nil {
+		variant = 1
+	}
+	for _, field := range results.Fields {
+		if field.Role == formLayout.ROLE_VARIANT {
+			// an unknown variant must be corrected, the sheet isn't graded against a guessed key
+			variant, err = test.ParseVariant(field.Current())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	GradeAnswers(&test, variant, results.SheetAnswers(), results)
+	results.Review = nil
+	err = CreateTestResultFile(testID+"$"+username, results)
+	if err != nil {
+		return nil, err
+	}
+	err = RecordBankStatistics(&test, results)
+	if err != nil {
+		return nil, err
+	}
+	err = updateShortResults(testID, username, func(result *PersonalResult) bool {
+		changed := result.Mark != results.Mark || result.Variant != results.Variant || result.NeedsReview
+		result.Mark = results.Mark
+		result.Variant = results.Variant
+		result.NeedsReview = false
+		return changed
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"tucklejudge/utils/formLayout"
+)
+
+// scoring policies of a question
+const CREDIT_ALL = "all"         // all-or-nothing
+const CREDIT_DIGITS = "digits"   // share of points for every correct digit on its place
+const CREDIT_OPTIONS = "options" // share of points for every chosen correct option
+
+var CreditPolicies = []string{CREDIT_ALL, CREDIT_DIGITS, CREDIT_OPTIONS}
+
+func IsValidCredit(credit string) bool {
+	for _, c := range CreditPolicies {
+		if c == credit {
+			return true
+		}
+	}
+	return false
+}
+
+// CutAnswer leaves only the part of recognized answer which matters for the question
+func (q *Question) CutAnswer(userAnswer string) string {
+	if q.Credit == CREDIT_OPTIONS {
+		// options may be chosen in any order and number, so blank cells between them don't matter,
+		// sheets checked before blanks were told from zeros have zeros in unfilled cells
+		userAnswer = strings.ReplaceAll(userAnswer, formLayout.BLANK_CELL, "")
+		if !strings.Contains(q.Answer, "0") {
+			userAnswer = strings.TrimRight(userAnswer, "0")
+		}
+		return userAnswer
+	}
+	// a blank answer of a sheet checked before blanks were told from zeros is zeros in every cell,
+	// so zeros longer than the answer are taken for a blank one, not for a wrong one
+	if len(userAnswer) > len(q.Answer) && strings.Trim(userAnswer, "0") == "" {
+		return ""
+	}
+	if len(userAnswer) > len(q.Answer) {
+		return userAnswer[:len(q.Answer)]
+	}
+	return userAnswer
+}
+
+// Score returns points received for the (already cut) answer, it's negative when penalty outweighs credit
+func (q *Question) Score(userAnswer string) int {
+	if len(q.Answer) == 0 {
+		return q.Points
+	}
+	// blank answer is neither credited nor penalized
+	if len(userAnswer) == 0 {
+		return 0
+	}
+	switch q.Credit {
+	case CREDIT_DIGITS:
+		correct := 0
+		for i := 0; i < len(q.Answer) && i < len(userAnswer); i++ {
+			if q.Answer[i] == userAnswer[i] {
+				correct++
+			}
+		}
+		if correct == 0 {
+			return -q.Penalty
+		}
+		return q.Points * correct / len(q.Answer)
+	case CREDIT_OPTIONS:
+		// an option repeated in the key is still one option
+		options := make(map[rune]bool)
+		for _, option := range q.Answer {
+			options[option] = true
+		}
+		correct, wrong := 0, 0
+		chosen := make(map[rune]bool)
+		for _, option := range userAnswer {
+			if chosen[option] {
+				continue
+			}
+			chosen[option] = true
+			if options[option] {
+				correct++
+			} else {
+				wrong++
+			}
+		}
+		return q.Points*correct/len(options) - q.Penalty*wrong
+	default:
+		if userAnswer == q.Answer {
+			return q.Points
+		}
+		return -q.Penalty
+	}
+}
+
+// SumWithSectionFloors sums points of the questions, total of every section can't be less than zero
+func SumWithSectionFloors(questions []Question, points []int) int {
+	sections := make(map[string]int)
+	for i, q := range questions {
+		sections[q.Section] += points[i]
+	}
+	sum := 0
+	for _, sectionSum := range sections {
+		if sectionSum > 0 {
+			sum += sectionSum
+		}
+	}
+	return sum
+}
+
+// GradeAnswers fills results with grading of the recognized answers (one per question) against the variant's key
+func GradeAnswers(test *Test, variant int, answers []string, results *PersonalTest) {
+	key := test.KeyForVariant(variant)
+	results.TestName = test.Name
+	results.Variant = fmt.Sprint(variant)
+	results.KeyVersion = fmt.Sprint(test.Version)
+	results.RecognizedAnswers = answers
+	results.Questions = make([]PersonalQuestion, len(key))
+	questionsPoints := make([]int, len(key))
+	for i, q := range key {
+		userAnswer := ""
+		if i < len(answers) {
+			userAnswer = q.CutAnswer(answers[i])
+		}
+		questionsPoints[i] = q.Score(userAnswer)
+		results.Questions[i].Index = fmt.Sprint(i+1)
+		results.Questions[i].UserAnswer = userAnswer
+		results.Questions[i].CorrectAnswer = q.Answer
+		results.Questions[i].Points = fmt.Sprint(questionsPoints[i])
+		results.Questions[i].Credit = q.Credit
+		results.Questions[i].Penalty = fmt.Sprint(q.Penalty)
+		results.Questions[i].Section = q.Section
+	}
+	numericPointsSum := SumWithSectionFloors(key, questionsPoints)
+	results.PointsSum = fmt.Sprint(numericPointsSum)
+	results.Mark = test.Scale.Mark(numericPointsSum, test.MaxPoints())
+	results.MarkBounds = test.Scale.MarkBounds(test.MaxPoints())
+}
@@ -0,0 +1,123 @@
+package sheetCode
+
+// Timing-mark code printed on generated answer sheets. It's two rows of square cells placed by the form layout:
+// the upper row alternates black and white cells and shows where the cells are and how dark black is,
+// in the lower row black cells are ones of the payload followed by CRC-8.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const TEST_ID_BITS = 14
+const USER_ID_BITS = 14
+const VARIANT_BITS = 3
+const PAGE_BITS = 4
+const CRC_BITS = 8
+const BITS = TEST_ID_BITS + USER_ID_BITS + VARIANT_BITS + PAGE_BITS + CRC_BITS
+
+// UNKNOWN_ID is encoded when the sheet isn't pre-printed for a student
+const UNKNOWN_ID = 1<<USER_ID_BITS - 1
+
+type Code struct {
+	TestID  string
+	UserID  string // empty for sheets which aren't pre-printed
+	Variant int    // 0 when the variant isn't pre-printed
+	Page    int    // sheets are numbered from 1
+}
+
+var ErrNoCode = errors.New("Sheet has no readable code")
+var ErrCorruptedCode = errors.New("Sheet code has wrong checksum")
+
+func crc8(bits []bool) uint8 {
+	var crc uint8
+	for _, bit := range bits {
+		top := crc&0x80 != 0
+		crc <<= 1
+		if top != bit {
+			crc ^= 0x07
+		}
+	}
+	return crc
+}
+
+func appendNumber(bits []bool, value, width int) []bool {
+	for i := width - 1; i >= 0; i-- {
+		bits = append(bits, value>>i&1 == 1)
+	}
+	return bits
+}
+
+func readNumber(bits []bool, width int) (int, []bool) {
+	value := 0
+	for i := 0; i < width; i++ {
+		value <<= 1
+		if bits[i] {
+			value |= 1
+		}
+	}
+	return value, bits[width:]
+}
+
+func parseID(id string, width int) (int, error) {
+	if id == "" {
+		return 1<<width - 1, nil
+	}
+	value, err := strconv.Atoi(id)
+	if err != nil || value < 0 || value >= 1<<width-1 {
+		return 0, errors.New(fmt.Sprintf("ID %s can't be encoded", id))
+	}
+	return value, nil
+}
+
+// Encode returns the data row of the code
+func Encode(code *Code) ([]bool, error) {
+	testID, err := parseID(code.TestID, TEST_ID_BITS)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := parseID(code.UserID, USER_ID_BITS)
+	if err != nil {
+		return nil, err
+	}
+	if code.Variant < 0 || code.Variant >= 1<<VARIANT_BITS || code.Page < 0 || code.Page >= 1<<PAGE_BITS {
+		return nil, errors.New(fmt.Sprintf("Variant %d or page %d can't be encoded", code.Variant, code.Page))
+	}
+	bits := make([]bool, 0, BITS)
+	bits = appendNumber(bits, testID, TEST_ID_BITS)
+	bits = appendNumber(bits, userID, USER_ID_BITS)
+	bits = appendNumber(bits, code.Variant, VARIANT_BITS)
+	bits = appendNumber(bits, code.Page, PAGE_BITS)
+	return appendNumber(bits, int(crc8(bits)), CRC_BITS), nil
+}
+
+// Decode checks the checksum of the data row, IDs are formatted as 4 digits like the handwritten ones
+func Decode(bits []bool) (*Code, error) {
+	if len(bits) != BITS {
+		return nil, ErrNoCode
+	}
+	payload := bits[:BITS-CRC_BITS]
+	checksum, _ := readNumber(bits[BITS-CRC_BITS:], CRC_BITS)
+	if uint8(checksum) != crc8(payload) {
+		return nil, ErrCorruptedCode
+	}
+	code := &Code{}
+	testID, rest := readNumber(payload, TEST_ID_BITS)
+	userID, rest := readNumber(rest, USER_ID_BITS)
+	code.Variant, rest = readNumber(rest, VARIANT_BITS)
+	code.Page, _ = readNumber(rest, PAGE_BITS)
+	if testID == 1<<TEST_ID_BITS-1 {
+		return nil, ErrCorruptedCode
+	}
+	code.TestID = fmt.Sprintf("%04d", testID)
+	if userID != UNKNOWN_ID {
+		code.UserID = fmt.Sprintf("%04d", userID)
+	}
+	return code, nil
+}
+
+// TimingCell tells whether the cell of the upper row is black
+func TimingCell(i int) bool {
+	return i%2 == 0
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// rights of the teachers for a test, every right includes the previous ones
+const RIGHT_NONE = ""
+const RIGHT_VIEW = "view"   // viewing the key and results of the students
+const RIGHT_CHECK = "check" // checking sheets of the test
+const RIGHT_EDIT = "edit"   // changing the key
+const RIGHT_OWNER = "owner" // sharing, archiving and deleting
+
+var CollaboratorRights = []string{RIGHT_VIEW, RIGHT_CHECK, RIGHT_EDIT}
+
+type Collaborator struct {
+	Username string
+	Right string // one of CollaboratorRights
+}
+
+func rightLevel(right string) int {
+	switch right {
+	case RIGHT_VIEW:
+		return 1
+	case RIGHT_CHECK:
+		return 2
+	case RIGHT_EDIT:
+		return 3
+	case RIGHT_OWNER:
+		return 4
+	}
+	return 0
+}
+
+func IsValidCollaboratorRight(right string) bool {
+	level := rightLevel(right)
+	return level > 0 && level < rightLevel(RIGHT_OWNER)
+}
+
+// GetTestRight returns the right of the teacher for the test
+func GetTestRight(test *Test, username string) string {
+	if test.Owner == username {
+		return RIGHT_OWNER
+	}
+	for _, c := range test.Collaborators {
+		if c.Username == username {
+			return c.Right
+		}
+	}
+	if test.Owner == "" {
+		// tests created before ownership can be edited by every teacher who has them in the list,
+		// the list doesn't tell the creator, so the owner is the teacher who saves the test first
+		user, err := GetAccauntInfo(username)
+		if err != nil || !user.Teacher {
+			return RIGHT_NONE
+		}
+		for _, id := range user.Tests {
+			if id == test.ID {
+				return RIGHT_EDIT
+			}
+		}
+	}
+	return RIGHT_NONE
+}
+
+func HasTestRight(test *Test, username string, right string) bool {
+	return rightLevel(GetTestRight(test, username)) >= rightLevel(right)
+}
+
+// SaveTestSettings saves ownership, sharing and archiving, they aren't a part of the key so no new version is created
+func SaveTestSettings(test *Test) error {
+	TestFilesMutex.Lock()
+	defer TestFilesMutex.Unlock()
+	return SaveTestToFile(test)
+}
+
+// DeleteTest removes the test, its versions and results of the students, ID is removed from the lists of all users
+// and the results are removed from the statistics of the bank
+func DeleteTest(test *Test) error {
+	err := DeleteBankStatistics(test.ID)
+	if err != nil {
+		return err
+	}
+	usernames, err := GetTestResultsUsernames(test.ID)
+	if err != nil {
+		return err
+	}
+	for _, username := range usernames {
+		err = os.Remove(fmt.Sprintf("%s/%s$%s.txt", TEST_RESULTS_FOLDER, test.ID, username))
+		if err != nil {
+			return err
+		}
+	}
+	b, err := os.ReadFile("authentication/users.txt")
+	if err != nil {
+		return err
+	}
+	for _, username := range strings.Fields(string(b)) {
+		err = DeleteTestFromUsersList(username, test.ID)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	TestFilesMutex.Lock()
+	defer TestFilesMutex.Unlock()
+	err = os.RemoveAll(fmt.Sprintf("%s/%s", TEST_VERSIONS_FOLDER, test.ID))
+	if err != nil {
+		return err
+	}
+	return os.Remove(fmt.Sprintf("tester/tests/%s.txt", test.ID))
+}
+
+// CheckTestRight returns an error when the teacher can't do the action with the test
+func CheckTestRight(test *Test, username string, right string) error {
+	if !HasTestRight(test, username, right) {
+		return errors.New(fmt.Sprintf("%s has no %s right for test %s", username, right, test.ID))
+	}
+	if test.Archived && rightLevel(right) >= rightLevel(RIGHT_CHECK) && right != RIGHT_OWNER {
+		return errors.New(fmt.Sprintf("Test %s is archived", test.ID))
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const MAX_QUESTIONS = 30
+const MAX_ANSWER_LENGTH = 8
+
+// KeyRowError is a validation error of one question (row) of an imported key, rows are numbered from 1
+type KeyRowError struct {
+	Row int
+	Message string
+}
+
+func (e KeyRowError) Error() string {
+	if e.Row == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// keyQuestion is a question of a JSON key, "answer" is a shortcut for a single variant
+type keyQuestion struct {
+	Answer string `json:"answer,omitempty"`
+	Answers []string `json:"answers,omitempty"`
+	Points *int `json:"points,omitempty"`
+	Credit string `json:"credit,omitempty"`
+	Penalty int `json:"penalty,omitempty"`
+	Section string `json:"section,omitempty"`
+}
+
+type keyTest struct {
+	Name string `json:"name"`
+	Scale string `json:"scale,omitempty"`
+	Questions []keyQuestion `json:"questions"`
+}
+
+// validateKeyQuestion converts an imported question, all problems of the row are reported
+func validateKeyQuestion(row int, q *keyQuestion) (Question, []KeyRowError) {
+	var errs []KeyRowError
+	question := Question{
+		Answers: q.Answers,
+		Points: 1,
+		Credit: strings.ToLower(strings.TrimSpace(q.Credit)),
+		Penalty: q.Penalty,
+		Section: strings.TrimLeft(strings.Join(strings.Fields(q.Section), "_"), "#"),
+	}
+	if len(question.Answers) == 0 {
+		question.Answers = []string{q.Answer}
+	}
+	// trailing empty variants are dropped
+	for len(question.Answers) > 1 && strings.TrimSpace(question.Answers[len(question.Answers)-1]) == "" {
+		question.Answers = question.Answers[:len(question.Answers)-1]
+	}
+	if len(question.Answers) > MAX_VARIANTS {
+		errs = append(errs, KeyRowError{row, fmt.Sprintf("%d variants given, at most %d are allowed", len(question.Answers), MAX_VARIANTS)})
+	}
+	for v := range question.Answers {
+		answer := strings.TrimSpace(question.Answers[v])
+		question.Answers[v] = answer
+		if answer == "" {
+			errs = append(errs, KeyRowError{row, fmt.Sprintf("answer of variant %d is empty", v+1)})
+		} else if len(answer) > MAX_ANSWER_LENGTH {
+			errs = append(errs, KeyRowError{row, fmt.Sprintf("answer %s is longer than %d digits", answer, MAX_ANSWER_LENGTH)})
+		} else if strings.Trim(answer, "0123456789") != "" {
+			errs = append(errs, KeyRowError{row, fmt.Sprintf("answer %s contains not only digits", answer)})
+		}
+	}
+	question.Answer = question.Answers[0]
+	if q.Points != nil {
+		question.Points = *q.Points
+	}
+	if question.Points < 0 {
+		errs = append(errs, KeyRowError{row, fmt.Sprintf("points %d are negative", question.Points)})
+	}
+	if question.Penalty < 0 {
+		errs = append(errs, KeyRowError{row, fmt.Sprintf("penalty %d is negative", question.Penalty)})
+	}
+	if question.Credit == "" {
+		question.Credit = CREDIT_ALL
+	} else if !IsValidCredit(question.Credit) {
+		errs = append(errs, KeyRowError{row, fmt.Sprintf("credit %s is unknown, use one of %s", question.Credit, strings.Join(CreditPolicies, ", "))})
+	}
+	return question, errs
+}
+
+func validateKeyTest(key *keyTest) (Test, []KeyRowError) {
+	var test Test
+	var errs []KeyRowError
+	test.Name = strings.TrimSpace(key.Name)
+	if len(key.Questions) == 0 {
+		return test, []KeyRowError{{0, "key has no questions"}}
+	}
+	if len(key.Questions) > MAX_QUESTIONS {
+		errs = append(errs, KeyRowError{0, fmt.Sprintf("key has %d questions, at most %d are allowed", len(key.Questions), MAX_QUESTIONS)})
+	}
+	test.Questions = make([]Question, len(key.Questions))
+	for i := range key.Questions {
+		var rowErrs []KeyRowError
+		test.Questions[i], rowErrs = validateKeyQuestion(i+1, &key.Questions[i])
+		errs = append(errs, rowErrs...)
+	}
+	return test, errs
+}
+
+// the rows of a CSV key before its header which keep the name and the grading scale of the test
+const KEY_CSV_NAME = "#name"
+const KEY_CSV_SCALE = "#scale"
+
+// ParseKeyCSV reads a key with the header "question,answer1,...,points,credit,penalty,section",
+// only answer columns are required and "answer" is the same as "answer1". The header may follow
+// the optional rows "#name,<test name>" and "#scale,<scale name>"
+func ParseKeyCSV(in io.Reader) (Test, []KeyRowError) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Test{}, []KeyRowError{{0, err.Error()}}
+	}
+	key := &keyTest{}
+	for len(records) > 0 && strings.HasPrefix(strings.TrimSpace(records[0][0]), "#") {
+		value := ""
+		if len(records[0]) > 1 {
+			value = strings.TrimSpace(records[0][1])
+		}
+		switch strings.ToLower(strings.TrimSpace(records[0][0])) {
+		case KEY_CSV_NAME:
+			key.Name = value
+		case KEY_CSV_SCALE:
+			key.Scale = value
+		default:
+			return Test{}, []KeyRowError{{0, fmt.Sprintf("row %s before the header is unknown, use %s or %s", records[0][0], KEY_CSV_NAME, KEY_CSV_SCALE)}}
+		}
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		return Test{}, []KeyRowError{{0, "file is empty"}}
+	}
+	columns := make(map[string]int)
+	answerColumns := make([]int, 0)
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "answer" {
+			name = "answer1"
+		}
+		columns[name] = i
+	}
+	for v := 1; ; v++ {
+		column, ok := columns[fmt.Sprintf("answer%d", v)]
+		if !ok {
+			break
+		}
+		answerColumns = append(answerColumns, column)
+	}
+	if len(answerColumns) == 0 {
+		return Test{}, []KeyRowError{{0, "header has no answer column"}}
+	}
+
+	var errs []KeyRowError
+	for i, record := range records[1:] {
+		row := i+1
+		cell := func(name string) string {
+			column, ok := columns[name]
+			if !ok || column >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[column])
+		}
+		q := keyQuestion{
+			Credit: cell("credit"),
+			Section: cell("section"),
+		}
+		for _, column := range answerColumns {
+			answer := ""
+			if column < len(record) {
+				answer = record[column]
+			}
+			q.Answers = append(q.Answers, answer)
+		}
+		if points := cell("points"); points != "" {
+			p, err := strconv.Atoi(points)
+			if err != nil {
+				errs = append(errs, KeyRowError{row, fmt.Sprintf("points %s are not a number", points)})
+			}
+			q.Points = &p
+		}
+		if penalty := cell("penalty"); penalty != "" {
+			q.Penalty, err = strconv.Atoi(penalty)
+			if err != nil {
+				errs = append(errs, KeyRowError{row, fmt.Sprintf("penalty %s is not a number", penalty)})
+			}
+		}
+		if index := cell("question"); index != "" && index != fmt.Sprint(row) {
+			errs = append(errs, KeyRowError{row, fmt.Sprintf("question number %s is out of order", index)})
+		}
+		key.Questions = append(key.Questions, q)
+	}
+	test, validationErrs := validateKeyTest(key)
+	errs = append(errs, validationErrs...)
+	if key.Scale != "" {
+		test.Scale.Name = key.Scale
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Row < errs[j].Row
+	})
+	return test, errs
+}
+
+func ParseKeyJSON(in io.Reader) (Test, []KeyRowError) {
+	key := &keyTest{}
+	decoder := json.NewDecoder(in)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(key)
+	if err != nil {
+		return Test{}, []KeyRowError{{0, err.Error()}}
+	}
+	test, errs := validateKeyTest(key)
+	if key.Scale != "" {
+		test.Scale.Name = key.Scale
+	}
+	return test, errs
+}
+
+// ParseKey chooses the parser by the file name
+func ParseKey(filename string, in io.Reader) (Test, []KeyRowError) {
+	if strings.HasSuffix(strings.ToLower(filename), ".json") {
+		return ParseKeyJSON(in)
+	}
+	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		return ParseKeyCSV(in)
+	}
+	return Test{}, []KeyRowError{{0, fmt.Sprintf("file %s is neither .csv nor .json", filename)}}
+}
+
+func ExportKeyCSV(test *Test) ([]byte, error) {
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	err := writer.WriteAll([][]string{{KEY_CSV_NAME, test.Name}, {KEY_CSV_SCALE, test.Scale.Name}})
+	if err != nil {
+		return nil, err
+	}
+	variants := test.NumberOfVariants()
+	header := []string{"question"}
+	for v := 1; v <= variants; v++ {
+		header = append(header, fmt.Sprintf("answer%d", v))
+	}
+	header = append(header, "points", "credit", "penalty", "section")
+	err = writer.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	for i, q := range test.Questions {
+		record := []string{fmt.Sprint(i+1)}
+		for v := 0; v < variants; v++ {
+			answer := ""
+			if v < len(q.Answers) {
+				answer = q.Answers[v]
+			}
+			record = append(record, answer)
+		}
+		record = append(record, fmt.Sprint(q.Points), q.Credit, fmt.Sprint(q.Penalty), q.Section)
+		err = writer.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return out.Bytes(), writer.Error()
+}
+
+func ExportKeyJSON(test *Test) ([]byte, error) {
+	key := keyTest{
+		Name: test.Name,
+		Scale: test.Scale.Name,
+		Questions: make([]keyQuestion, len(test.Questions)),
+	}
+	for i, q := range test.Questions {
+		points := q.Points
+		key.Questions[i] = keyQuestion{
+			Answers: q.Answers,
+			Points: &points,
+			Credit: q.Credit,
+			Penalty: q.Penalty,
+			Section: q.Section,
+		}
+	}
+	return json.MarshalIndent(key, "", "\t")
+}
@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TEST_VERSIONS_FOLDER = "tester/testVersions"
+const TEST_RESULTS_FOLDER = "tester/testResults"
+const TEACHER_RESULTS_FOLDER = "tester/teacherTestResults"
+
+type RegradedResult struct {
+	Username string
+	FullName string
+	OldMark, NewMark string
+	OldPoints, NewPoints string
+	Regraded bool // results checked before versioning have no recognized answers and can't be regraded
+}
+
+// DiffTests describes what has changed between two versions of the test
+func DiffTests(previous, test *Test) (changes []string) {
+	if previous.Name != test.Name {
+		changes = append(changes, fmt.Sprintf("name: %s -> %s", previous.Name, test.Name))
+	}
+	if len(previous.Questions) != len(test.Questions) {
+		changes = append(changes, fmt.Sprintf("number of questions: %d -> %d", len(previous.Questions), len(test.Questions)))
+	}
+	if previous.NumberOfVariants() != test.NumberOfVariants() {
+		changes = append(changes, fmt.Sprintf("number of variants: %d -> %d", previous.NumberOfVariants(), test.NumberOfVariants()))
+	}
+	for i := 0; i < len(previous.Questions) && i < len(test.Questions); i++ {
+		p := &previous.Questions[i]
+		q := &test.Questions[i]
+		for v := 1; v <= test.NumberOfVariants() && v <= previous.NumberOfVariants(); v++ {
+			oldAnswer := previous.KeyForVariant(v)[i].Answer
+			newAnswer := test.KeyForVariant(v)[i].Answer
+			if oldAnswer != newAnswer {
+				changes = append(changes, fmt.Sprintf("question %d, variant %d: answer %s -> %s", i+1, v, oldAnswer, newAnswer))
+			}
+		}
+		if p.Points != q.Points {
+			changes = append(changes, fmt.Sprintf("question %d: points %d -> %d", i+1, p.Points, q.Points))
+		}
+		if p.Credit != q.Credit || p.Penalty != q.Penalty || p.Section != q.Section {
+			changes = append(changes, fmt.Sprintf("question %d: scoring %s/-%d/%s -> %s/-%d/%s", i+1, p.Credit, p.Penalty, p.Section, q.Credit, q.Penalty, q.Section))
+		}
+	}
+	if previous.Scale.Name != test.Scale.Name || previous.Scale.Percentage != test.Scale.Percentage ||
+		previous.Scale.BoundsString() != test.Scale.BoundsString() || previous.Scale.MarksString() != test.Scale.MarksString() {
+		changes = append(changes, fmt.Sprintf("grading scale: %s (%s: %s) -> %s (%s: %s)", previous.Scale.Name, previous.Scale.MarksString(), previous.Scale.BoundsString(),
+			test.Scale.Name, test.Scale.MarksString(), test.Scale.BoundsString()))
+	}
+	return changes
+}
+
+// SaveNewTestVersion archives the current version of the test, saves the new one and logs the changes
+func SaveNewTestVersion(test *Test) (changes []string, err error) {
+	previous, err := GetTestByID(test.ID)
+	if err != nil {
+		return nil, err
+	}
+	test.Version = previous.Version + 1
+	changes = DiffTests(&previous, test)
+
+	TestFilesMutex.Lock()
+	defer TestFilesMutex.Unlock()
+
+	folder := fmt.Sprintf("%s/%s", TEST_VERSIONS_FOLDER, test.ID)
+	err = os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(fmt.Sprintf("tester/tests/%s.txt", test.ID))
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(fmt.Sprintf("%s/%d.txt", folder, previous.Version), b, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = SaveTestToFile(test)
+	if err != nil {
+		return nil, err
+	}
+
+	// appending changes to the log of the test
+	f, err := os.OpenFile(fmt.Sprintf("%s/changes.txt", folder), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := fmt.Sprintf("Version %d (%s):", test.Version, time.Now().Format("2006-01-02 15:04"))
+	if len(changes) == 0 {
+		out += " no changes"
+	}
+	out += "\n"
+	for _, change := range changes {
+		out += "- " + change + "\n"
+	}
+	_, err = f.WriteString(out)
+	return changes, err
+}
+
+func GetTestChangeLog(testID string) ([]string, error) {
+	b, err := os.ReadFile(fmt.Sprintf("%s/%s/changes.txt", TEST_VERSIONS_FOLDER, testID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(b), "\n"), "\n"), nil
+}
+
+// GetTestResultsUsernames returns usernames of all students whose results of the test are saved
+func GetTestResultsUsernames(testID string) ([]string, error) {
+	entries, err := os.ReadDir(TEST_RESULTS_FOLDER)
+	if err != nil {
+		return nil, err
+	}
+	var usernames []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, testID+"$") && strings.HasSuffix(name, ".txt") {
+			usernames = append(usernames, name[len(testID+"$"):len(name)-len(".txt")])
+		}
+	}
+	return usernames, nil
+}
+
+// UpdateShortResultsMark changes the mark of the student in all teachers' summaries
+func UpdateShortResultsMark(testID, username, mark string) error {
+	return updateShortResults(testID, username, func(result *PersonalResult) bool {
+		changed := result.Mark != mark
+		result.Mark = mark
+		return changed
+	})
+}
+
+// updateShortResults applies the update to the result in every check, update tells whether the result was changed
+func updateShortResults(testID, username string, update func(result *PersonalResult) bool) error {
+	entries, err := os.ReadDir(TEACHER_RESULTS_FOLDER)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() == "currentID.txt" || !strings.HasSuffix(entry.Name(), ".txt") {
+			continue
+		}
+		filename := entry.Name()[:len(entry.Name())-len(".txt")]
+		results, err := LoadShortResultsFromFile(filename)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for i := range results.Results {
+			if results.Results[i].TestID == testID && results.Results[i].Username == username && update(&results.Results[i]) {
+				changed = true
+			}
+		}
+		if changed {
+			err = SaveShortResultsInfoToFile(filename, results)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RegradeTestResults grades saved recognized answers of all students against the current key
+func RegradeTestResults(test *Test) ([]RegradedResult, error) {
+	usernames, err := GetTestResultsUsernames(test.ID)
+	if err != nil {
+		return nil, err
+	}
+	regraded := make([]RegradedResult, 0, len(usernames))
+	for _, username := range usernames {
+		results, err := GetTestUsersResultByID(test.ID, username)
+		if err != nil {
+			return nil, err
+		}
+		current := RegradedResult{
+			Username: username,
+			FullName: username,
+			OldMark: results.Mark,
+			NewMark: results.Mark,
+			OldPoints: results.PointsSum,
+			NewPoints: results.PointsSum,
+		}
+		if user, err := GetAccauntInfo(username); err == nil {
+			current.FullName = user.Surname + " " + user.Name
+		}
+		if answers := results.SheetAnswers(); len(answers) > 0 {
+			variant, err := strconv.Atoi(results.Variant)
+			if err != nil {
+				variant = 1
+			}
+			GradeAnswers(test, variant, answers, results)
+			err = CreateTestResultFile(test.ID+"$"+username, results)
+			if err != nil {
+				return nil, err
+			}
+			err = RecordBankStatistics(test, results)
+			if err != nil {
+				return nil, err
+			}
+			err = UpdateShortResultsMark(test.ID, username, results.Mark)
+			if err != nil {
+				return nil, err
+			}
+			current.Regraded = true
+			current.NewMark = results.Mark
+			current.NewPoints = results.PointsSum
+		}
+		regraded = append(regraded, current)
+	}
+	return regraded, nil
+}